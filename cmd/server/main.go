@@ -64,13 +64,7 @@ func main() {
 		func(ctx context.Context, conn jsonrpc2.Conn) {
 			h := handler.NewHandler(logger, conn)
 
-			// Create a function adapter that matches jsonrpc2.Handler type
-			handlerFunc := func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
-				result, err := h.Handle(ctx, req)
-				return reply(ctx, result, err)
-			}
-
-			conn.Go(ctx, handlerFunc)
+			conn.Go(ctx, h.Serve)
 			<-conn.Done()
 			if err := conn.Err(); err != nil {
 				fmt.Fprintf(os.Stderr, "Connection closed with error: %v\n", err)
@@ -87,13 +81,7 @@ func runServer(ctx context.Context, stream jsonrpc2.Stream, logger *util.Logger)
 	conn := jsonrpc2.NewConn(stream)
 	h := handler.NewHandler(logger, conn)
 
-	// Create a function adapter that matches jsonrpc2.Handler type
-	handlerFunc := func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
-		result, err := h.Handle(ctx, req)
-		return reply(ctx, result, err)
-	}
-
-	conn.Go(ctx, handlerFunc)
+	conn.Go(ctx, h.Serve)
 	<-conn.Done()
 	if err := conn.Err(); err != nil {
 		fmt.Fprintf(os.Stderr, "Connection closed with error: %v\n", err)
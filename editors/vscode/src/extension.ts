@@ -31,8 +31,10 @@ export function activate(context: vscode.ExtensionContext) {
     const clientOptions: LanguageClientOptions = {
         documentSelector: [{ scheme: 'file', language: 'carrion' }],
         synchronize: {
+            configurationSection: 'carrion',
             fileEvents: vscode.workspace.createFileSystemWatcher('**/*.crl')
         },
+        initializationOptions: vscode.workspace.getConfiguration('carrion'),
         outputChannelName: 'Carrion Language Server',
         traceOutputChannelName: 'Carrion Language Server Trace'
     };
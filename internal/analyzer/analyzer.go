@@ -1,9 +1,11 @@
 package analyzer
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/javanhut/TheCarrionLanguage/src/ast"
 	"github.com/javanhut/TheCarrionLanguage/src/lexer"
@@ -15,11 +17,30 @@ import (
 	"github.com/carrionlang-lsp/lsp/internal/util"
 )
 
-// CarrionAnalyzer provides language analysis for Carrion language files
+// CarrionAnalyzer provides language analysis for Carrion language files.
+//
+// Queries only read the snapshots and the symbol table and may run
+// concurrently with each other. Methods changing them or the settings, such
+// as AnalyzeDocument, IndexProgram, ReindexFile and the Set methods, must not
+// run concurrently with anything but queries on views.
 type CarrionAnalyzer struct {
 	logger        *util.Logger
 	documentStore *protocol.CarrionDocumentStore
-	symbolTable   *symbols.SymbolTable
+	// symbolTable is the symbol table of the workspace. Changes modify it in
+	// place unless tableShared is set, in which case snapshots or views read
+	// it and they modify a copy instead.
+	symbolTable *symbols.SymbolTable
+	tableShared atomic.Bool
+	// snapshots holds the latest snapshot of each analyzed open document. The
+	// map is replaced rather than modified, so that views can share it.
+	snapshots        map[lsp.DocumentURI]*Snapshot
+	workspaceFolders []string
+	// resolveCodeActions is set when the client resolves code action edits lazily
+	resolveCodeActions  bool
+	semanticTokensCache *semanticTokensCache
+	diagnosticsCache    *diagnosticsCache
+	// inlayHints selects the kinds of inlay hints to show
+	inlayHints InlayHintSettings
 }
 
 // NewCarrionAnalyzer creates a new analyzer
@@ -31,15 +52,27 @@ func NewCarrionAnalyzer(
 		logger:        logger,
 		documentStore: docStore,
 		symbolTable:   symbols.NewSymbolTable(),
+		snapshots:     make(map[lsp.DocumentURI]*Snapshot),
+
+		semanticTokensCache: &semanticTokensCache{
+			results: make(map[lsp.DocumentURI]semanticTokensResult),
+		},
+		diagnosticsCache: &diagnosticsCache{
+			files: make(map[lsp.DocumentURI]cachedDiagnostics),
+		},
+		inlayHints: DefaultInlayHintSettings(),
 	}
 }
 
-// AnalyzeDocument analyzes a document and returns diagnostics
-func (a *CarrionAnalyzer) AnalyzeDocument(uri lsp.DocumentURI) []lsp.Diagnostic {
+// AnalyzeDocument analyzes the current version of a document, storing its
+// snapshot, and returns its diagnostics. Once ctx is cancelled it stops
+// early with its error and stores no snapshot; the symbol table may know the
+// new version already, until the analysis of a later one replaces it.
+func (a *CarrionAnalyzer) AnalyzeDocument(ctx context.Context, uri lsp.DocumentURI) ([]lsp.Diagnostic, error) {
 	doc := a.documentStore.GetDocument(uri)
 	if doc == nil {
 		a.logger.Warn("Cannot analyze non-existent document: %s", uri)
-		return nil
+		return nil, nil
 	}
 
 	// Parse the document
@@ -48,28 +81,39 @@ func (a *CarrionAnalyzer) AnalyzeDocument(uri lsp.DocumentURI) []lsp.Diagnostic
 	program := p.ParseProgram()
 
 	// Collect diagnostics from parser errors
-	diagnostics := make([]lsp.Diagnostic, 0)
+	diagnostics := a.parseErrorDiagnostics(p.Errors(), doc.Text)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	if len(p.Errors()) > 0 {
-		for _, err := range p.Errors() {
-			diagnostic := a.createDiagnosticFromError(err)
-			diagnostics = append(diagnostics, diagnostic)
-		}
+	// Build symbol table for the document
+	if len(p.Errors()) == 0 {
+		a.writableSymbols().BuildFromAST(program, string(uri), doc.Text)
+		a.resolveImports(uri)
+		diagnostics = append(diagnostics, a.checkImports(doc)...)
 	}
 
-	// Additional semantic analysis when parsing succeeds
+	// Additional semantic analysis when parsing succeeds, once the symbol
+	// table knows the document
 	if len(p.Errors()) == 0 && program != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		// Check for undefined variables, unused imports, etc.
 		semanticDiagnostics := a.performSemanticAnalysis(program, doc)
 		diagnostics = append(diagnostics, semanticDiagnostics...)
 	}
 
-	// Build symbol table for the document
-	if len(p.Errors()) == 0 {
-		a.symbolTable.BuildFromAST(program, string(uri))
-	}
-
-	return diagnostics
+	// Store the snapshot only once complete, as views may read it right away
+	a.storeSnapshot(&Snapshot{
+		Document:    doc,
+		Program:     program,
+		ParseErrors: p.Errors(),
+		Diagnostics: diagnostics,
+		Symbols:     a.symbolTable,
+	})
+	a.tableShared.Store(true)
+	return diagnostics, nil
 }
 
 // GetCompletions returns completion items at the given position
@@ -77,7 +121,7 @@ func (a *CarrionAnalyzer) GetCompletions(
 	uri lsp.DocumentURI,
 	position lsp.Position,
 ) []lsp.CompletionItem {
-	doc := a.documentStore.GetDocument(uri)
+	doc := a.Document(uri)
 	if doc == nil {
 		a.logger.Warn("Cannot get completions for non-existent document: %s", uri)
 		return nil
@@ -90,12 +134,13 @@ func (a *CarrionAnalyzer) GetCompletions(
 	}
 
 	line := lines[position.Line]
-	if int(position.Character) > len(line) {
-		position.Character = uint32(len(line))
+	column := byteColumn(lines, position)
+	if column > len(line) {
+		column = len(line)
 	}
 
 	// Get text before cursor position to determine context
-	textBeforeCursor := line[:position.Character]
+	textBeforeCursor := line[:column]
 
 	// Determine if we're after a dot (e.g., object.???)
 	isDotCompletion := false
@@ -172,25 +217,24 @@ func (a *CarrionAnalyzer) getSelfCompletions(
 		return nil
 	}
 
-	completions := []lsp.CompletionItem{}
+	return a.memberCompletions(currentGrimoire)
+}
 
-	// Add Grimoire methods
-	for _, method := range currentGrimoire.Methods {
-		completions = append(completions, lsp.CompletionItem{
-			Label:         method.Name,
-			Kind:          lsp.CompletionItemKindMethod,
-			Detail:        "method of " + currentGrimoire.Name,
-			Documentation: method.Documentation,
-		})
-	}
+// memberCompletions returns the methods and fields of a Grimoire, including
+// inherited ones, detailed with the Grimoire defining each
+func (a *CarrionAnalyzer) memberCompletions(Grimoire *symbols.GrimoireSymbol) []lsp.CompletionItem {
+	completions := []lsp.CompletionItem{}
 
-	// Add Grimoire fields
-	for _, field := range currentGrimoire.Fields {
+	for _, member := range a.symbolTable.Members(Grimoire) {
+		kind := lsp.CompletionItemKindField
+		if member.Type == "method" {
+			kind = lsp.CompletionItemKindMethod
+		}
 		completions = append(completions, lsp.CompletionItem{
-			Label:         field.Name,
-			Kind:          lsp.CompletionItemKindField,
-			Detail:        "field of " + currentGrimoire.Name,
-			Documentation: field.Documentation,
+			Label:         member.Name,
+			Kind:          kind,
+			Detail:        member.Type + " of " + member.GrimoireName,
+			Documentation: member.Documentation,
 		})
 	}
 
@@ -210,29 +254,33 @@ func (a *CarrionAnalyzer) getObjectCompletions(
 
 	completions := []lsp.CompletionItem{}
 
-	// Get the object's type (Grimoire)
-	if symbol.Type == "instance" || symbol.Type == "variable" {
-		Grimoire := a.symbolTable.LookupGrimoire(symbol.GrimoireName)
-		if Grimoire != nil {
-			// Add methods
-			for _, method := range Grimoire.Methods {
+	// Modules imported under an alias expose their top-level names
+	if symbol.Type == "import" {
+		if imp := a.symbolTable.ImportFor(symbol.Name, string(uri)); imp != nil {
+			for _, member := range a.symbolTable.ModuleSymbols(imp) {
+				kind := lsp.CompletionItemKindVariable
+				switch member.Type {
+				case "Grimoire":
+					kind = lsp.CompletionItemKindClass
+				case "spell":
+					kind = lsp.CompletionItemKindFunction
+				}
 				completions = append(completions, lsp.CompletionItem{
-					Label:         method.Name,
-					Kind:          lsp.CompletionItemKindMethod,
-					Detail:        "method of " + Grimoire.Name,
-					Documentation: method.Documentation,
+					Label:         member.Name,
+					Kind:          kind,
+					Detail:        member.Type + " from " + imp.Path,
+					Documentation: member.Documentation,
 				})
 			}
+		}
+		return completions
+	}
 
-			// Add fields
-			for _, field := range Grimoire.Fields {
-				completions = append(completions, lsp.CompletionItem{
-					Label:         field.Name,
-					Kind:          lsp.CompletionItemKindField,
-					Detail:        "field of " + Grimoire.Name,
-					Documentation: field.Documentation,
-				})
-			}
+	// Get the object's type (Grimoire)
+	if symbol.Type == "instance" || symbol.Type == "variable" {
+		Grimoire := a.symbolTable.LookupGrimoire(symbol.GrimoireName)
+		if Grimoire != nil {
+			completions = append(completions, a.memberCompletions(Grimoire)...)
 		}
 	}
 
@@ -538,14 +586,26 @@ func (a *CarrionAnalyzer) getOSGrimoireCompletions() []lsp.CompletionItem {
 	return completions
 }
 
-// getMethodsAndFieldsForGrimoire returns method and field completions for a custom grimoire
+// getMethodsAndFieldsForGrimoire returns method and field completions for a
+// custom grimoire, including those it inherits
 func (a *CarrionAnalyzer) getMethodsAndFieldsForGrimoire(grimoire *symbols.GrimoireSymbol) []lsp.CompletionItem {
 	completions := []lsp.CompletionItem{}
 	
-	// Add methods
-	for _, method := range grimoire.Methods {
+	for _, member := range a.symbolTable.Members(grimoire) {
+		// Fields
+		if member.Type != "method" {
+			completions = append(completions, lsp.CompletionItem{
+				Label:         member.Name,
+				Kind:          lsp.CompletionItemKindField,
+				Detail:        "field of " + member.GrimoireName,
+				Documentation: member.Documentation,
+			})
+			continue
+		}
+
+		// Methods
 		var paramStrs []string
-		for _, param := range method.Parameters {
+		for _, param := range member.Parameters {
 			paramStr := param.Name
 			if param.TypeHint != "" {
 				paramStr += ": " + param.TypeHint
@@ -556,23 +616,17 @@ func (a *CarrionAnalyzer) getMethodsAndFieldsForGrimoire(grimoire *symbols.Grimo
 			paramStrs = append(paramStrs, paramStr)
 		}
 		
-		signature := method.Name + "(" + strings.Join(paramStrs, ", ") + ")"
+		signature := member.Name + "(" + strings.Join(paramStrs, ", ") + ")"
+		if member.GrimoireName != grimoire.Name {
+			// Name the ancestor an inherited method comes from
+			signature = member.GrimoireName + "." + signature
+		}
 		
 		completions = append(completions, lsp.CompletionItem{
-			Label:         method.Name,
+			Label:         member.Name,
 			Kind:          lsp.CompletionItemKindMethod,
 			Detail:        signature,
-			Documentation: method.Documentation,
-		})
-	}
-	
-	// Add fields
-	for _, field := range grimoire.Fields {
-		completions = append(completions, lsp.CompletionItem{
-			Label:         field.Name,
-			Kind:          lsp.CompletionItemKindField,
-			Detail:        "field of " + grimoire.Name,
-			Documentation: field.Documentation,
+			Documentation: member.Documentation,
 		})
 	}
 	
@@ -771,7 +825,7 @@ func (a *CarrionAnalyzer) FindDefinition(
 	uri lsp.DocumentURI,
 	position lsp.Position,
 ) []lsp.Location {
-	doc := a.documentStore.GetDocument(uri)
+	doc := a.Document(uri)
 	if doc == nil {
 		a.logger.Warn("Cannot find definition in non-existent document: %s", uri)
 		return nil
@@ -784,70 +838,64 @@ func (a *CarrionAnalyzer) FindDefinition(
 	}
 
 	line := lines[position.Line]
-	if int(position.Character) >= len(line) {
+	column := byteColumn(lines, position)
+	if column >= len(line) {
 		return nil
 	}
 
 	// Extract the symbol name at the current position
-	symbolName, _ := a.getSymbolAtPosition(line, position.Character)
+	symbolName, _, _ := a.getSymbolAtPosition(line, column)
 	if symbolName == "" {
 		return nil
 	}
 
-	// Look up the symbol in the symbol table
-	symbol := a.symbolTable.LookupSymbol(symbolName, string(uri))
+	// Look up the symbol in the symbol table, through the reference under the
+	// cursor when the name was resolved in its scope
+	symbol := a.symbolAtPosition(uri, position)
+	if symbol == nil {
+		symbol = a.symbolTable.LookupSymbol(symbolName, string(uri))
+	}
 	if symbol == nil {
 		return nil
 	}
 
-	// Create a location for the definition
+	// Create a location for the definition, covering the defined name rather
+	// than the keyword before it
 	locations := []lsp.Location{
 		{
-			URI: lsp.DocumentURI(symbol.DefinitionURI),
-			Range: lsp.Range{
-				Start: lsp.Position{
-					Line:      uint32(symbol.DefinitionLine),
-					Character: uint32(symbol.DefinitionColumn),
-				},
-				End: lsp.Position{
-					Line:      uint32(symbol.DefinitionLine),
-					Character: uint32(symbol.DefinitionColumn + len(symbolName)),
-				},
-			},
+			URI:   lsp.DocumentURI(symbol.DefinitionURI),
+			Range: a.symbolNameRange(symbol),
 		},
 	}
 
 	return locations
 }
 
-// getSymbolAtPosition extracts the symbol name at the given position in a line
-func (a *CarrionAnalyzer) getSymbolAtPosition(line string, charPos uint32) (string, lsp.Range) {
-	if int(charPos) >= len(line) {
-		return "", lsp.Range{}
+// getSymbolAtPosition extracts the symbol name at a byte column of a line,
+// along with the byte columns where it starts and ends
+func (a *CarrionAnalyzer) getSymbolAtPosition(line string, column int) (string, int, int) {
+	if column >= len(line) {
+		return "", 0, 0
 	}
 
 	// Find the start of the symbol (non-whitespace, non-punctuation)
-	start := int(charPos)
+	start := column
 	for start > 0 && isIdentifierChar(line[start-1]) {
 		start--
 	}
 
 	// Find the end of the symbol
-	end := int(charPos)
+	end := column
 	for end < len(line) && isIdentifierChar(line[end]) {
 		end++
 	}
 
 	// Extract the symbol name
 	if start < end {
-		symbolRange := lsp.Range{
-			Start: lsp.Position{Character: uint32(start)},
-			End:   lsp.Position{Character: uint32(end)},
-		}
-		return line[start:end], symbolRange
+		return line[start:end], start, end
 	}
 
-	return "", lsp.Range{}
+	return "", 0, 0
 }
 
 // isIdentifierChar returns true if the character is valid in an identifier
@@ -859,7 +907,7 @@ func isIdentifierChar(c byte) bool {
 
 // GetHoverInfo returns hover information for a symbol at the given position
 func (a *CarrionAnalyzer) GetHoverInfo(uri lsp.DocumentURI, position lsp.Position) *lsp.Hover {
-	doc := a.documentStore.GetDocument(uri)
+	doc := a.Document(uri)
 	if doc == nil {
 		a.logger.Warn("Cannot get hover info for non-existent document: %s", uri)
 		return nil
@@ -872,15 +920,22 @@ func (a *CarrionAnalyzer) GetHoverInfo(uri lsp.DocumentURI, position lsp.Positio
 	}
 
 	line := lines[position.Line]
-	if int(position.Character) >= len(line) {
+	column := byteColumn(lines, position)
+	if column >= len(line) {
 		return nil
 	}
 
 	// Extract the symbol name at the current position
-	symbolName, symbolRange := a.getSymbolAtPosition(line, position.Character)
+	symbolName, start, end := a.getSymbolAtPosition(line, column)
 	if symbolName == "" {
 		return nil
 	}
+	symbolRange := spanRange(symbols.Span{
+		StartLine:   int(position.Line),
+		StartColumn: start,
+		EndLine:     int(position.Line),
+		EndColumn:   end,
+	}, lines)
 
 	// Check if it's a keyword
 	if isCarrionKeyword(symbolName) {
@@ -891,7 +946,10 @@ func (a *CarrionAnalyzer) GetHoverInfo(uri lsp.DocumentURI, position lsp.Positio
 	}
 
 	// Look up the symbol in the symbol table
-	symbol := a.symbolTable.LookupSymbol(symbolName, string(uri))
+	symbol := a.symbolAtPosition(uri, position)
+	if symbol == nil {
+		symbol = a.symbolTable.LookupSymbol(symbolName, string(uri))
+	}
 	if symbol == nil {
 		return nil
 	}
@@ -918,6 +976,8 @@ func (a *CarrionAnalyzer) GetHoverInfo(uri lsp.DocumentURI, position lsp.Positio
 			symbol.ValueType,
 			symbol.Documentation,
 		)
+	case "import":
+		content = fmt.Sprintf("**import** \"%s\" as %s", symbol.ValueType, symbol.Name)
 	case "field":
 		content = fmt.Sprintf(
 			"**field** %s of %s\n\n%s",
@@ -1020,7 +1080,11 @@ func formatKeywordDocumentation(keyword string) string {
 }
 
 // createDiagnosticFromError creates a diagnostic from a parser error
-func (a *CarrionAnalyzer) createDiagnosticFromError(err string) lsp.Diagnostic {
+func (a *CarrionAnalyzer) createDiagnosticFromError(
+	err string,
+	positions *symbols.PositionMap,
+	lines []string,
+) lsp.Diagnostic {
 	// Extract line and column information if available
 	lineNum, colNum := 1, 1
 	errMsg := err
@@ -1044,18 +1108,19 @@ func (a *CarrionAnalyzer) createDiagnosticFromError(err string) lsp.Diagnostic {
 		}
 	}
 
+	// Underline the token the error is reported at, or the character before
+	// it at the end of a line
+	span := positions.TokenSpanAt(lineNum-1, colNum-1)
+	if !span.IsValid() {
+		span = symbols.Span{StartLine: lineNum - 1, StartColumn: colNum - 1, EndLine: lineNum - 1, EndColumn: colNum - 1}
+	}
+	if span.StartColumn == span.EndColumn && span.StartColumn > 0 {
+		span.StartColumn--
+	}
+
 	// Create a diagnostic for the error
 	return lsp.Diagnostic{
-		Range: lsp.Range{
-			Start: lsp.Position{
-				Line:      uint32(lineNum - 1),
-				Character: uint32(colNum - 1),
-			},
-			End: lsp.Position{
-				Line:      uint32(lineNum - 1),
-				Character: uint32(colNum + 10), // Estimate end position
-			},
-		},
+		Range:    spanRange(span, lines),
 		Severity: protocol.DiagnosticSeverity["error"],
 		Source:   "carrion-lsp",
 		Message:  errMsg,
@@ -1070,9 +1135,15 @@ func (a *CarrionAnalyzer) performSemanticAnalysis(program *ast.Program, doc *pro
 	stringIndexDiagnostics := a.checkStringIndexing(program, doc)
 	diagnostics = append(diagnostics, stringIndexDiagnostics...)
 
+	// Check for names that are not defined in any enclosing scope
+	undefinedDiagnostics := a.checkUndefinedNames(doc, program)
+	diagnostics = append(diagnostics, undefinedDiagnostics...)
+
+	// Check for unused variables, parameters and imports
+	unusedDiagnostics := a.checkUnused(doc)
+	diagnostics = append(diagnostics, unusedDiagnostics...)
+
 	// TODO: Implement additional semantic analysis
-	// - Check for undefined variables
-	// - Check for unused imports
 	// - Check for type mismatches
 	// - Check for unreachable code
 	// - etc.
@@ -1107,7 +1178,7 @@ func (a *CarrionAnalyzer) GetSignatureHelp(
 	uri lsp.DocumentURI,
 	position lsp.Position,
 ) *lsp.SignatureHelp {
-	doc := a.documentStore.GetDocument(uri)
+	doc := a.Document(uri)
 	if doc == nil {
 		a.logger.Warn("Cannot get signature help for non-existent document: %s", uri)
 		return nil
@@ -1120,12 +1191,13 @@ func (a *CarrionAnalyzer) GetSignatureHelp(
 	}
 
 	line := lines[position.Line]
-	if int(position.Character) > len(line) {
+	column := byteColumn(lines, position)
+	if column > len(line) {
 		return nil
 	}
 
 	// Find the function call context
-	funcName, paramIndex := a.getFunctionCallContext(line, position.Character)
+	funcName, paramIndex := a.getFunctionCallContext(line, column)
 	if funcName == "" {
 		return nil
 	}
@@ -1172,12 +1244,12 @@ func (a *CarrionAnalyzer) GetSignatureHelp(
 }
 
 // getFunctionCallContext analyzes the current position to find function call context
-func (a *CarrionAnalyzer) getFunctionCallContext(line string, charPos uint32) (string, int) {
+func (a *CarrionAnalyzer) getFunctionCallContext(line string, column int) (string, int) {
 	// Find the opening parenthesis
 	parenPos := -1
 	parenDepth := 0
 	
-	for i := int(charPos) - 1; i >= 0; i-- {
+	for i := column - 1; i >= 0; i-- {
 		if line[i] == ')' {
 			parenDepth++
 		} else if line[i] == '(' {
@@ -1213,7 +1285,7 @@ func (a *CarrionAnalyzer) getFunctionCallContext(line string, charPos uint32) (s
 	
 	// Count commas to determine parameter index
 	paramIndex := 0
-	for i := parenPos + 1; i < int(charPos); i++ {
+	for i := parenPos + 1; i < column; i++ {
 		if line[i] == ',' {
 			paramIndex++
 		}
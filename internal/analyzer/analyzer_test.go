@@ -0,0 +1,92 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/util"
+)
+
+// testWorkspace is an analyzer over a temporary workspace folder
+type testWorkspace struct {
+	*CarrionAnalyzer
+	t    *testing.T
+	root string
+}
+
+// newTestWorkspace writes files, named by their slash-separated path, to a
+// new workspace folder and returns an analyzer that opened and analyzed those
+// named by open, in order
+func newTestWorkspace(t *testing.T, files map[string]string, open ...string) *testWorkspace {
+	t.Helper()
+	root := t.TempDir()
+	for name, text := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := util.NewLogger(util.StderrLogger{})
+	a := NewCarrionAnalyzer(logger, protocol.NewDocumentStore(logger))
+	a.SetWorkspaceFolders([]lsp.DocumentURI{uri.File(root)})
+	w := &testWorkspace{CarrionAnalyzer: a, t: t, root: root}
+	for _, name := range open {
+		a.documentStore.AddDocument(w.uri(name), "carrion", files[name], 1)
+		w.analyze(name)
+	}
+	return w
+}
+
+// uri returns the URI of a file of the workspace
+func (w *testWorkspace) uri(name string) lsp.DocumentURI {
+	return uri.File(filepath.Join(w.root, filepath.FromSlash(name)))
+}
+
+// path returns the path of a file of the workspace
+func (w *testWorkspace) path(name string) string {
+	return filepath.Join(w.root, filepath.FromSlash(name))
+}
+
+// analyze analyzes the current version of an open file
+func (w *testWorkspace) analyze(name string) {
+	w.t.Helper()
+	if _, err := w.AnalyzeDocument(context.Background(), w.uri(name)); err != nil {
+		w.t.Fatal(err)
+	}
+}
+
+// change replaces the content of an open file and analyzes it
+func (w *testWorkspace) change(name, text string) {
+	w.t.Helper()
+	doc := w.documentStore.GetDocument(w.uri(name))
+	changes := []protocol.TextDocumentContentChangeEvent{{Text: text}}
+	if _, err := w.documentStore.UpdateDocument(w.uri(name), changes, doc.Version+1); err != nil {
+		w.t.Fatal(err)
+	}
+	w.analyze(name)
+}
+
+// messages returns the messages of the diagnostics of an open file
+func (w *testWorkspace) messages(name string) []string {
+	messages := make([]string, 0)
+	for _, diagnostic := range w.Snapshot(w.uri(name)).Diagnostics {
+		messages = append(messages, diagnostic.Message)
+	}
+	return messages
+}
+
+// analyzeText returns the messages of the diagnostics of a single document
+func analyzeText(t *testing.T, text string) []string {
+	t.Helper()
+	return newTestWorkspace(t, map[string]string{"test.crl": text}, "test.crl").messages("test.crl")
+}
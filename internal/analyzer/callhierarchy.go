@@ -0,0 +1,309 @@
+package analyzer
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// PrepareCallHierarchy returns the spell or method at the given position as
+// the root of a call hierarchy. A Grimoire stands for its init method, which
+// calling the Grimoire invokes.
+func (a *CarrionAnalyzer) PrepareCallHierarchy(uri lsp.DocumentURI, position lsp.Position) []lsp.CallHierarchyItem {
+	doc := a.Document(uri)
+	if doc == nil {
+		a.logger.Warn("Cannot prepare call hierarchy for non-existent document: %s", uri)
+		return nil
+	}
+
+	lines := strings.Split(doc.Text, "\n")
+	ref := a.symbolTable.ReferenceAt(string(uri), int(position.Line), byteColumn(lines, position))
+	if ref == nil {
+		return nil
+	}
+
+	callable := a.callableSymbol(a.symbolTable.SymbolForReference(ref))
+	if callable == nil {
+		return nil
+	}
+	return []lsp.CallHierarchyItem{a.callHierarchyItem(callable)}
+}
+
+// GetIncomingCalls returns the spells and methods calling the given item,
+// with the ranges of the calls. Calls made at the top level of a file come
+// from an item standing for the file. It returns nil once ctx is cancelled.
+func (a *CarrionAnalyzer) GetIncomingCalls(ctx context.Context, item lsp.CallHierarchyItem) []lsp.CallHierarchyIncomingCall {
+	target := a.callHierarchySymbol(item)
+	if target == nil {
+		return nil
+	}
+
+	refs := a.symbolTable.FindReferences(target, false)
+	if target.Type == "method" && target.Name == "init" {
+		if Grimoire := a.symbolTable.LookupGlobalSymbol(target.GrimoireName, target.DefinitionURI); Grimoire != nil && Grimoire.Type == "Grimoire" {
+			refs = append(refs, a.symbolTable.FindReferences(Grimoire, false)...)
+		}
+	}
+	sortReferences(refs)
+
+	calls := make(map[callSite]*lsp.CallHierarchyIncomingCall)
+	sites := make([]callSite, 0)
+	files := newCallFiles(a)
+	for _, ref := range refs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		file := files.get(ref.URI)
+		if file == nil || !isCall(file.lines, ref) {
+			continue
+		}
+
+		site := callSite{uri: ref.URI, caller: file.callerOf(ref.Scope)}
+		call, ok := calls[site]
+		if !ok {
+			from := a.fileCallHierarchyItem(ref.URI, file.lines)
+			if site.caller != nil {
+				from = a.callHierarchyItem(site.caller)
+			}
+			call = &lsp.CallHierarchyIncomingCall{From: from}
+			calls[site] = call
+			sites = append(sites, site)
+		}
+		call.FromRanges = append(call.FromRanges, callRange(ref, file.lines))
+	}
+
+	incoming := make([]lsp.CallHierarchyIncomingCall, 0, len(sites))
+	for _, site := range sites {
+		incoming = append(incoming, *calls[site])
+	}
+	return incoming
+}
+
+// GetOutgoingCalls returns the spells and methods the given item calls, with
+// the ranges of the calls within it. It returns nil once ctx is cancelled.
+func (a *CarrionAnalyzer) GetOutgoingCalls(ctx context.Context, item lsp.CallHierarchyItem) []lsp.CallHierarchyOutgoingCall {
+	uri := string(item.URI)
+	var caller *symbols.Symbol
+	if item.Kind != lsp.SymbolKindFile {
+		caller = a.callHierarchySymbol(item)
+		if caller == nil {
+			return nil
+		}
+		uri = caller.DefinitionURI
+	}
+
+	file := newCallFiles(a).get(uri)
+	if file == nil {
+		return nil
+	}
+
+	refs := make([]*symbols.Reference, 0)
+	for _, ref := range a.symbolTable.References[uri] {
+		if !ref.IsDeclaration && file.callerOf(ref.Scope) == caller && isCall(file.lines, ref) {
+			refs = append(refs, ref)
+		}
+	}
+	sortReferences(refs)
+
+	calls := make(map[*symbols.Symbol]*lsp.CallHierarchyOutgoingCall)
+	callees := make([]*symbols.Symbol, 0)
+	for _, ref := range refs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		callee := a.callableSymbol(a.symbolTable.SymbolForReference(ref))
+		if callee == nil {
+			continue
+		}
+
+		call, ok := calls[callee]
+		if !ok {
+			call = &lsp.CallHierarchyOutgoingCall{To: a.callHierarchyItem(callee)}
+			calls[callee] = call
+			callees = append(callees, callee)
+		}
+		call.FromRanges = append(call.FromRanges, callRange(ref, file.lines))
+	}
+
+	outgoing := make([]lsp.CallHierarchyOutgoingCall, 0, len(callees))
+	for _, callee := range callees {
+		outgoing = append(outgoing, *calls[callee])
+	}
+	return outgoing
+}
+
+// callSite identifies the spell or method making calls, nil for the top level
+// of a file
+type callSite struct {
+	uri    string
+	caller *symbols.Symbol
+}
+
+// callableSymbol returns the spell or method invoked by calling a symbol: the
+// symbol itself, or the init method of a Grimoire
+func (a *CarrionAnalyzer) callableSymbol(symbol *symbols.Symbol) *symbols.Symbol {
+	if symbol == nil {
+		return nil
+	}
+
+	switch symbol.Type {
+	case "spell", "method":
+		return symbol
+	case "Grimoire":
+		if Grimoire := a.symbolTable.LookupGrimoire(symbol.Name); Grimoire != nil {
+			return a.symbolTable.LookupMember(Grimoire, "init")
+		}
+	}
+	return nil
+}
+
+// callHierarchySymbol finds the spell or method a call hierarchy item was
+// made for from the position of its name
+func (a *CarrionAnalyzer) callHierarchySymbol(item lsp.CallHierarchyItem) *symbols.Symbol {
+	symbol := a.symbolAtPosition(item.URI, item.SelectionRange.Start)
+	if symbol == nil || (symbol.Type != "spell" && symbol.Type != "method") {
+		return nil
+	}
+	return symbol
+}
+
+// callHierarchyItem describes a spell or method in a call hierarchy. Methods
+// are named after their Grimoire to tell them apart across files.
+func (a *CarrionAnalyzer) callHierarchyItem(symbol *symbols.Symbol) lsp.CallHierarchyItem {
+	name := symbol.Name
+	kind := lsp.SymbolKindFunction
+	if symbol.Type == "method" {
+		name = symbol.GrimoireName + "." + symbol.Name
+		kind = lsp.SymbolKindMethod
+		if symbol.Name == "init" {
+			kind = lsp.SymbolKindConstructor
+		}
+	}
+
+	return lsp.CallHierarchyItem{
+		Name:           name,
+		Kind:           kind,
+		Detail:         "(" + parameterList(symbol.Parameters) + ")",
+		URI:            lsp.DocumentURI(symbol.DefinitionURI),
+		Range:          a.definitionRange(symbol),
+		SelectionRange: a.symbolNameRange(symbol),
+	}
+}
+
+// fileCallHierarchyItem describes the top level of a file, which makes the
+// calls outside any spell
+func (a *CarrionAnalyzer) fileCallHierarchyItem(uri string, lines []string) lsp.CallHierarchyItem {
+	name := uri
+	if path, ok := uriToPath(lsp.DocumentURI(uri)); ok {
+		name = filepath.Base(path)
+	}
+
+	last := len(lines) - 1
+	return lsp.CallHierarchyItem{
+		Name:  name,
+		Kind:  lsp.SymbolKindFile,
+		URI:   lsp.DocumentURI(uri),
+		Range: spanRange(symbols.Span{EndLine: last, EndColumn: len(lines[last])}, lines),
+	}
+}
+
+// callFiles caches the lines and spell scopes of the files calls are looked
+// up in
+type callFiles struct {
+	a     *CarrionAnalyzer
+	files map[string]*callFile
+}
+
+// callFile holds the lines of a file and the spell or method owning each
+// of its function scopes
+type callFile struct {
+	lines   []string
+	callers map[*symbols.Scope]*symbols.Symbol
+}
+
+func newCallFiles(a *CarrionAnalyzer) *callFiles {
+	return &callFiles{a: a, files: make(map[string]*callFile)}
+}
+
+// get returns the cached file, nil when its text cannot be read
+func (c *callFiles) get(uri string) *callFile {
+	if file, ok := c.files[uri]; ok {
+		return file
+	}
+
+	var file *callFile
+	if text, ok := c.a.documentText(lsp.DocumentURI(uri)); ok {
+		file = &callFile{
+			lines:   strings.Split(text, "\n"),
+			callers: make(map[*symbols.Scope]*symbols.Symbol),
+		}
+		if fileScope, ok := c.a.symbolTable.FileScopes[uri]; ok {
+			file.addCallers(fileScope)
+		}
+	}
+	c.files[uri] = file
+	return file
+}
+
+// addCallers records the spells and methods defined in a scope and those
+// nested in them
+func (f *callFile) addCallers(scope *symbols.Scope) {
+	names := make([]string, 0, len(scope.Symbols))
+	for name := range scope.Symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		symbol := scope.Symbols[name]
+		if symbol.Scope == nil {
+			continue
+		}
+		switch symbol.Type {
+		case "spell":
+			f.callers[symbol.Scope] = symbol
+			f.addCallers(symbol.Scope)
+		case "Grimoire":
+			if symbol.Scope.Grimoire == nil {
+				continue
+			}
+			for _, method := range symbol.Scope.Grimoire.Methods {
+				if method.Scope != nil {
+					f.callers[method.Scope] = method
+					f.addCallers(method.Scope)
+				}
+			}
+		}
+	}
+}
+
+// callerOf returns the innermost spell or method whose body holds a scope,
+// nil at the top level of the file
+func (f *callFile) callerOf(scope *symbols.Scope) *symbols.Symbol {
+	for ; scope != nil; scope = scope.Parent {
+		if caller, ok := f.callers[scope]; ok {
+			return caller
+		}
+	}
+	return nil
+}
+
+// isCall reports whether a reference is the callee of a call, its name
+// followed by an opening parenthesis
+func isCall(lines []string, ref *symbols.Reference) bool {
+	if ref.Line >= len(lines) || ref.Column+len(ref.Name) > len(lines[ref.Line]) {
+		return false
+	}
+	rest := lines[ref.Line][ref.Column+len(ref.Name):]
+	return strings.HasPrefix(strings.TrimLeft(rest, " \t"), "(")
+}
+
+// callRange returns the range of the callee name of a call
+func callRange(ref *symbols.Reference, lines []string) lsp.Range {
+	return spanRange(referenceSpan(ref), lines)
+}
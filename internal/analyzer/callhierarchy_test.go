@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// callHierarchyFiles define a Grimoire in one file and call it from another
+var callHierarchyFiles = map[string]string{
+	"shapes.crl": "" +
+		"grim Calc:\n" +
+		"    spell init(base):\n" +
+		"        self.base = base\n" +
+		"    spell double(x):\n" +
+		"        return x * 2\n",
+	"main.crl": "" +
+		"import \"shapes\"\n" +
+		"spell run(n):\n" +
+		"    c = Calc(n)\n" +
+		"    return c.double(n) + c.double(1)\n" +
+		"run(2)\n",
+}
+
+// callRanges returns the ranges of calls on one line
+func callRanges(line uint32, columns ...uint32) []lsp.Range {
+	ranges := make([]lsp.Range, 0, len(columns)/2)
+	for i := 0; i+1 < len(columns); i += 2 {
+		ranges = append(ranges, lsp.Range{
+			Start: lsp.Position{Line: line, Character: columns[i]},
+			End:   lsp.Position{Line: line, Character: columns[i+1]},
+		})
+	}
+	return ranges
+}
+
+// prepareCallHierarchy returns the call hierarchy item at a position of a file
+func (w *testWorkspace) prepareCallHierarchy(name string, line, character uint32) lsp.CallHierarchyItem {
+	w.t.Helper()
+	items := w.PrepareCallHierarchy(w.uri(name), lsp.Position{Line: line, Character: character})
+	if len(items) != 1 {
+		w.t.Fatalf("PrepareCallHierarchy(%s, %d:%d) = %v, want one item", name, line, character, items)
+	}
+	return items[0]
+}
+
+func TestOutgoingCalls(t *testing.T) {
+	w := newTestWorkspace(t, callHierarchyFiles, "shapes.crl", "main.crl")
+
+	run := w.prepareCallHierarchy("main.crl", 1, 7)
+	if run.Name != "run" || run.Kind != lsp.SymbolKindFunction {
+		t.Errorf("prepared item = %+v, want the run spell", run)
+	}
+
+	type call struct {
+		name   string
+		uri    lsp.DocumentURI
+		ranges []lsp.Range
+	}
+	want := []call{
+		{"Calc.init", w.uri("shapes.crl"), callRanges(2, 8, 12)},
+		{"Calc.double", w.uri("shapes.crl"), callRanges(3, 13, 19, 27, 33)},
+	}
+	got := make([]call, 0)
+	for _, outgoing := range w.GetOutgoingCalls(context.Background(), run) {
+		got = append(got, call{outgoing.To.Name, outgoing.To.URI, outgoing.FromRanges})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetOutgoingCalls = %+v, want %+v", got, want)
+	}
+}
+
+func TestIncomingCalls(t *testing.T) {
+	w := newTestWorkspace(t, callHierarchyFiles, "shapes.crl", "main.crl")
+
+	tests := []struct {
+		name      string
+		file      string
+		line      uint32
+		character uint32
+		from      string
+		ranges    []lsp.Range
+	}{
+		{"method across files", "shapes.crl", 3, 11, "run", callRanges(3, 13, 19, 27, 33)},
+		{"init through its Grimoire", "shapes.crl", 1, 11, "run", callRanges(2, 8, 12)},
+		{"top level of a file", "main.crl", 1, 7, "main.crl", callRanges(4, 0, 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := w.prepareCallHierarchy(tt.file, tt.line, tt.character)
+			incoming := w.GetIncomingCalls(context.Background(), item)
+			if len(incoming) != 1 {
+				t.Fatalf("GetIncomingCalls = %+v, want one caller", incoming)
+			}
+			if incoming[0].From.Name != tt.from || incoming[0].From.URI != w.uri("main.crl") {
+				t.Errorf("caller = %+v, want %s in main.crl", incoming[0].From, tt.from)
+			}
+			if !reflect.DeepEqual(incoming[0].FromRanges, tt.ranges) {
+				t.Errorf("call ranges = %v, want %v", incoming[0].FromRanges, tt.ranges)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// quickFix computes the code actions fixing a diagnostic
+type quickFix func(a *CarrionAnalyzer, uri lsp.DocumentURI, diagnostic lsp.Diagnostic) []lsp.CodeAction
+
+// codeActionResolver computes the edit of a code action on codeAction/resolve
+type codeActionResolver func(a *CarrionAnalyzer, data codeActionData) (*lsp.WorkspaceEdit, error)
+
+// codeActionData identifies a code action whose edit is computed lazily
+type codeActionData struct {
+	URI      lsp.DocumentURI `json:"uri"`
+	Action   string          `json:"action"`
+	Name     string          `json:"name,omitempty"`
+	Target   string          `json:"target,omitempty"`
+	Position lsp.Position    `json:"position"`
+}
+
+// quickFixes maps diagnostic codes to the fixes offered for them
+var quickFixes = map[string][]quickFix{
+	"unused-variable":  {fixFromData},
+	"unused-parameter": {fixFromData},
+	"unused-import":    {fixFromData},
+	"undefined-name":   {fixQualifyWithSelf, fixImportSymbol, fixCreateSpell},
+}
+
+// refactorings are offered for the code at the range of a request
+var refactorings = []struct {
+	kind    lsp.CodeActionKind
+	actions func(a *CarrionAnalyzer, uri lsp.DocumentURI, rng lsp.Range) []lsp.CodeAction
+}{
+	{lsp.RefactorRewrite, refactorAddSelfParameter},
+}
+
+// sourceActions are offered for a whole document, independently of diagnostics
+var sourceActions = []struct {
+	kind      lsp.CodeActionKind
+	title     string
+	action    string
+	available func(a *CarrionAnalyzer, uri lsp.DocumentURI) bool
+}{
+	{lsp.SourceOrganizeImports, "Organize imports", "organizeImports", importsNeedOrganizing},
+}
+
+// codeActionResolvers compute the edits of lazy code actions by action name
+var codeActionResolvers = map[string]codeActionResolver{
+	"importSymbol":    resolveImportSymbol,
+	"createSpell":     resolveCreateSpell,
+	"organizeImports": resolveOrganizeImports,
+}
+
+// CodeActionKinds returns the kinds of code actions the analyzer provides
+func CodeActionKinds() []lsp.CodeActionKind {
+	kinds := []lsp.CodeActionKind{lsp.QuickFix}
+	for _, refactoring := range refactorings {
+		kinds = append(kinds, refactoring.kind)
+	}
+	for _, source := range sourceActions {
+		kinds = append(kinds, source.kind)
+	}
+	return kinds
+}
+
+// SetCodeActionResolveSupport sets whether the client resolves the edits of
+// code actions lazily. Otherwise edits are computed with the actions.
+func (a *CarrionAnalyzer) SetCodeActionResolveSupport(supported bool) {
+	a.resolveCodeActions = supported
+}
+
+// GetCodeActions returns the quick fixes for the diagnostics of a request, the
+// refactorings of the code at its range and the source actions of the document
+func (a *CarrionAnalyzer) GetCodeActions(
+	uri lsp.DocumentURI,
+	rng lsp.Range,
+	context lsp.CodeActionContext,
+) []lsp.CodeAction {
+	actions := []lsp.CodeAction{}
+
+	if kindRequested(lsp.QuickFix, context.Only) {
+		for _, diagnostic := range context.Diagnostics {
+			code, _ := diagnostic.Code.(string)
+			if diagnostic.Source != "carrion-lsp" || code == "" {
+				continue
+			}
+			for _, fix := range quickFixes[code] {
+				actions = append(actions, fix(a, uri, diagnostic)...)
+			}
+		}
+	}
+
+	for _, refactoring := range refactorings {
+		if kindRequested(refactoring.kind, context.Only) {
+			actions = append(actions, refactoring.actions(a, uri, rng)...)
+		}
+	}
+
+	for _, source := range sourceActions {
+		if !kindRequested(source.kind, context.Only) || !source.available(a, uri) {
+			continue
+		}
+		action, ok := a.lazyAction(source.title, source.kind, nil, codeActionData{URI: uri, Action: source.action})
+		if ok {
+			actions = append(actions, action)
+		}
+	}
+
+	return actions
+}
+
+// ResolveCodeAction computes the edit of a code action returned without one
+func (a *CarrionAnalyzer) ResolveCodeAction(action lsp.CodeAction) (lsp.CodeAction, error) {
+	if action.Edit != nil {
+		return action, nil
+	}
+
+	var data codeActionData
+	if err := decodeData(action.Data, &data); err != nil {
+		return action, fmt.Errorf("invalid code action data: %w", err)
+	}
+
+	resolver, ok := codeActionResolvers[data.Action]
+	if !ok {
+		return action, fmt.Errorf("unknown code action %q", data.Action)
+	}
+
+	edit, err := resolver(a, data)
+	if err != nil {
+		return action, err
+	}
+	action.Edit = edit
+	return action, nil
+}
+
+// lazyAction builds a code action whose edit is computed by a resolver, right
+// away when the client does not resolve code actions. It reports false when
+// the edit cannot be computed.
+func (a *CarrionAnalyzer) lazyAction(
+	title string,
+	kind lsp.CodeActionKind,
+	diagnostics []lsp.Diagnostic,
+	data codeActionData,
+) (lsp.CodeAction, bool) {
+	action := lsp.CodeAction{
+		Title:       title,
+		Kind:        kind,
+		Diagnostics: diagnostics,
+		Data:        data,
+	}
+	if a.resolveCodeActions {
+		return action, true
+	}
+
+	resolved, err := a.ResolveCodeAction(action)
+	if err != nil {
+		a.logger.Debug("Dropping code action %q: %v", title, err)
+		return action, false
+	}
+	resolved.Data = nil
+	return resolved, true
+}
+
+// decodeData decodes data that came back from the client as generic JSON
+func decodeData(data interface{}, v interface{}) error {
+	if data == nil {
+		return fmt.Errorf("missing data")
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// kindRequested reports whether a code action kind passes the filter of a
+// request. A requested kind also matches its sub-kinds.
+func kindRequested(kind lsp.CodeActionKind, only []lsp.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, requested := range only {
+		if kind == requested || strings.HasPrefix(string(kind), string(requested)+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// codeActions returns the code actions of a file for its diagnostics, at a
+// line and of the given kinds
+func (w *testWorkspace) codeActions(name string, line uint32, only ...lsp.CodeActionKind) []lsp.CodeAction {
+	position := lsp.Position{Line: line}
+	return w.GetCodeActions(w.uri(name), lsp.Range{Start: position, End: position}, lsp.CodeActionContext{
+		Diagnostics: w.Snapshot(w.uri(name)).Diagnostics,
+		Only:        only,
+	})
+}
+
+// actionTitles returns the titles of code actions
+func actionTitles(actions []lsp.CodeAction) []string {
+	titles := make([]string, 0, len(actions))
+	for _, action := range actions {
+		titles = append(titles, action.Title)
+	}
+	return titles
+}
+
+func TestCodeActionKinds(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"a.crl": "grim A:\n    spell init():\n        ignore\n",
+		"b.crl": "grim B:\n    spell init():\n        ignore\n",
+		"main.crl": "import \"b\"\n" +
+			"import \"a\"\n" +
+			"x = A()\n" +
+			"y = B()\n" +
+			"greet(x, y)\n",
+	}, "a.crl", "b.crl", "main.crl")
+
+	tests := []struct {
+		name string
+		only []lsp.CodeActionKind
+		want []string
+	}{
+		{"all", nil, []string{"Create spell greet", "Organize imports"}},
+		{"quick fixes", []lsp.CodeActionKind{lsp.QuickFix}, []string{"Create spell greet"}},
+		{"source", []lsp.CodeActionKind{lsp.Source}, []string{"Organize imports"}},
+		{"organize imports", []lsp.CodeActionKind{lsp.SourceOrganizeImports}, []string{"Organize imports"}},
+		{"refactorings", []lsp.CodeActionKind{lsp.Refactor}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := actionTitles(w.codeActions("main.crl", 4, tt.only...)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("code actions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrganizeImports(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"a.crl": "grim A:\n    spell init():\n        ignore\n",
+		"b.crl": "grim B:\n    spell init():\n        ignore\n",
+		"c.crl": "grim C:\n    spell init():\n        ignore\n",
+		"main.crl": "import \"c\"\n" +
+			"import \"b\"\n" +
+			"import \"a\"\n" +
+			"x = A()\n" +
+			"y = B()\n" +
+			"print(x, y)\n",
+	}, "a.crl", "b.crl", "c.crl", "main.crl")
+
+	actions := w.codeActions("main.crl", 0, lsp.SourceOrganizeImports)
+	if len(actions) != 1 || actions[0].Edit == nil {
+		t.Fatalf("code actions = %v, want organize imports with its edit", actions)
+	}
+	want := []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 0}, End: lsp.Position{Line: 3}},
+		NewText: "import \"a\"\nimport \"b\"\n",
+	}}
+	if got := actions[0].Edit.Changes[w.uri("main.crl")]; !reflect.DeepEqual(got, want) {
+		t.Errorf("edits = %v, want %v", got, want)
+	}
+}
+
+func TestResolveCodeAction(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"main.crl": "s = \"é\" + greet(1, 2)\n",
+	}, "main.crl")
+	w.SetCodeActionResolveSupport(true)
+
+	actions := w.codeActions("main.crl", 0, lsp.QuickFix)
+	if len(actions) != 1 || actions[0].Edit != nil || actions[0].Data == nil {
+		t.Fatalf("code actions = %v, want create spell without its edit", actions)
+	}
+
+	resolved, err := w.ResolveCodeAction(actions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []lsp.TextEdit{{
+		Range:   lsp.Range{Start: lsp.Position{Line: 1}, End: lsp.Position{Line: 1}},
+		NewText: "\nspell greet(arg1, arg2):\n    ignore\n",
+	}}
+	if resolved.Edit == nil || !reflect.DeepEqual(resolved.Edit.Changes[w.uri("main.crl")], want) {
+		t.Errorf("resolved edit = %v, want %v", resolved.Edit, want)
+	}
+
+	if _, err := w.ResolveCodeAction(lsp.CodeAction{Data: codeActionData{Action: "unknown"}}); err == nil {
+		t.Error("resolving an unknown action succeeded")
+	}
+}
+
+func TestQualifyWithSelf(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"main.crl": "" +
+		"grim Counter:\n" +
+		"    spell init():\n" +
+		"        self.count = 0\n" +
+		"    spell show():\n" +
+		"        return \"é\" + str(count)\n",
+	}, "main.crl")
+
+	actions := w.codeActions("main.crl", 4, lsp.QuickFix)
+	if len(actions) != 1 || actions[0].Title != "Use self.count" {
+		t.Fatalf("code actions = %q, want to use self.count", actionTitles(actions))
+	}
+	// é is one UTF-16 code unit but two bytes
+	at := lsp.Position{Line: 4, Character: 25}
+	want := []lsp.TextEdit{{Range: lsp.Range{Start: at, End: at}, NewText: "self."}}
+	if got := actions[0].Edit.Changes[w.uri("main.crl")]; !reflect.DeepEqual(got, want) {
+		t.Errorf("edits = %v, want %v", got, want)
+	}
+}
+
+func TestAddSelfParameter(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"main.crl": "" +
+		"grim Dog:\n" +
+		"    spell speak(loud):\n" +
+		"        return loud\n" +
+		"    spell sit():\n" +
+		"        ignore\n" +
+		"    spell wait(self, seconds):\n" +
+		"        return seconds\n",
+	}, "main.crl")
+
+	tests := []struct {
+		line uint32
+		want []lsp.TextEdit
+	}{
+		{1, []lsp.TextEdit{{
+			Range:   lsp.Range{Start: lsp.Position{Line: 1, Character: 16}, End: lsp.Position{Line: 1, Character: 16}},
+			NewText: "self, ",
+		}}},
+		{3, []lsp.TextEdit{{
+			Range:   lsp.Range{Start: lsp.Position{Line: 3, Character: 14}, End: lsp.Position{Line: 3, Character: 14}},
+			NewText: "self",
+		}}},
+		{5, nil},
+		{2, nil},
+	}
+	for _, tt := range tests {
+		actions := w.codeActions("main.crl", tt.line, lsp.RefactorRewrite)
+		if tt.want == nil {
+			if len(actions) != 0 {
+				t.Errorf("line %d: code actions = %q, want none", tt.line, actionTitles(actions))
+			}
+			continue
+		}
+		if len(actions) != 1 {
+			t.Errorf("line %d: code actions = %q, want to add self", tt.line, actionTitles(actions))
+			continue
+		}
+		if got := actions[0].Edit.Changes[w.uri("main.crl")]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("line %d: edits = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
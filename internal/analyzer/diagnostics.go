@@ -0,0 +1,185 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javanhut/TheCarrionLanguage/src/lexer"
+	"github.com/javanhut/TheCarrionLanguage/src/parser"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// FileDiagnostics are the diagnostics of a file along with the result id
+// identifying them. Equal diagnostics get the same result id.
+type FileDiagnostics struct {
+	URI         lsp.DocumentURI
+	ResultID    string
+	Diagnostics []lsp.Diagnostic
+}
+
+// diagnosticsCache holds the diagnostics of the files that are not open. It
+// is shared by the views of an analyzer and diagnostic requests may run
+// concurrently, so it has its own lock.
+type diagnosticsCache struct {
+	mu    sync.Mutex
+	files map[lsp.DocumentURI]cachedDiagnostics
+}
+
+// cachedDiagnostics are the diagnostics of a file as it was on disk, along
+// with the scopes of the symbol table they were computed from: those of the
+// file and of the files it imports, directly or not
+type cachedDiagnostics struct {
+	modTime     time.Time
+	size        int64
+	scopes      []*symbols.Scope
+	diagnostics FileDiagnostics
+}
+
+// DocumentDiagnostics returns the diagnostics of a document: those of its
+// latest snapshot when it is open, those of its content on disk otherwise
+func (a *CarrionAnalyzer) DocumentDiagnostics(u lsp.DocumentURI) FileDiagnostics {
+	if snapshot, ok := a.snapshots[u]; ok {
+		return newFileDiagnostics(u, snapshot.Diagnostics)
+	}
+
+	path, ok := uriToPath(u)
+	if !ok {
+		return newFileDiagnostics(u, nil)
+	}
+	return a.diskDiagnostics(u, path)
+}
+
+// WorkspaceDiagnostics returns the diagnostics of the Carrion files of the
+// workspace that are not open, whose diagnostics DocumentDiagnostics returns.
+// It returns nil once ctx is cancelled.
+func (a *CarrionAnalyzer) WorkspaceDiagnostics(ctx context.Context) []FileDiagnostics {
+	files := make([]FileDiagnostics, 0)
+	for _, path := range a.WorkspaceFiles() {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		fileURI := uri.File(path)
+		if a.Document(fileURI) != nil {
+			continue
+		}
+		files = append(files, a.diskDiagnostics(fileURI, path))
+	}
+	return files
+}
+
+// diskDiagnostics returns the diagnostics of a file from its content on disk.
+// They are computed again only once the file changed on disk or the symbol
+// table indexed it or a file it imports again: indexing a file gives it a
+// new scope, so the scopes identify the versions the diagnostics depend on.
+func (a *CarrionAnalyzer) diskDiagnostics(fileURI lsp.DocumentURI, path string) FileDiagnostics {
+	info, err := os.Stat(path)
+	if err != nil {
+		return newFileDiagnostics(fileURI, nil)
+	}
+	scopes := a.dependencyScopes(string(fileURI))
+
+	cache := a.diagnosticsCache
+	cache.mu.Lock()
+	cached, ok := cache.files[fileURI]
+	cache.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() && slices.Equal(cached.scopes, scopes) {
+		return cached.diagnostics
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		a.logger.Warn("Cannot read %s: %v", path, err)
+		return newFileDiagnostics(fileURI, nil)
+	}
+	diagnostics := newFileDiagnostics(fileURI, a.textDiagnostics(fileURI, string(content)))
+
+	cache.mu.Lock()
+	cache.files[fileURI] = cachedDiagnostics{
+		modTime:     info.ModTime(),
+		size:        info.Size(),
+		scopes:      scopes,
+		diagnostics: diagnostics,
+	}
+	cache.mu.Unlock()
+	return diagnostics
+}
+
+// dependencyScopes returns the scope of a file in the symbol table followed by
+// those of the files it imports, directly or not, in a stable order. Files
+// that are not indexed get a nil scope.
+func (a *CarrionAnalyzer) dependencyScopes(fileURI string) []*symbols.Scope {
+	scopes := make([]*symbols.Scope, 0)
+	seen := make(map[string]bool)
+	var visit func(u string)
+	visit = func(u string) {
+		if u == "" || seen[u] {
+			return
+		}
+		seen[u] = true
+		scopes = append(scopes, a.symbolTable.FileScopes[u])
+		for _, imp := range a.symbolTable.Imports[u] {
+			visit(imp.URI)
+		}
+	}
+	visit(fileURI)
+	return scopes
+}
+
+// textDiagnostics returns the diagnostics of the content of a file that is not
+// open. Files that do not parse only get their parse errors, as the symbol
+// table does not index them.
+func (a *CarrionAnalyzer) textDiagnostics(fileURI lsp.DocumentURI, text string) []lsp.Diagnostic {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return a.parseErrorDiagnostics(p.Errors(), text)
+	}
+
+	if _, indexed := a.symbolTable.FileScopes[string(fileURI)]; !indexed || program == nil {
+		return []lsp.Diagnostic{}
+	}
+	doc := &protocol.CarrionDocument{URI: fileURI, Text: text}
+	diagnostics := a.checkImports(doc)
+	return append(diagnostics, a.performSemanticAnalysis(program, doc)...)
+}
+
+// parseErrorDiagnostics turns the errors of the parser into diagnostics
+func (a *CarrionAnalyzer) parseErrorDiagnostics(errs []string, text string) []lsp.Diagnostic {
+	diagnostics := make([]lsp.Diagnostic, 0, len(errs))
+	lines := strings.Split(text, "\n")
+	positions := symbols.NewPositionMap(text)
+	for _, err := range errs {
+		diagnostics = append(diagnostics, a.createDiagnosticFromError(err, positions, lines))
+	}
+	return diagnostics
+}
+
+// newFileDiagnostics identifies the diagnostics of a file by a hash of their
+// content
+func newFileDiagnostics(fileURI lsp.DocumentURI, diagnostics []lsp.Diagnostic) FileDiagnostics {
+	if diagnostics == nil {
+		diagnostics = []lsp.Diagnostic{}
+	}
+
+	hash := fnv.New64a()
+	if err := json.NewEncoder(hash).Encode(diagnostics); err != nil {
+		return FileDiagnostics{URI: fileURI, Diagnostics: diagnostics}
+	}
+	return FileDiagnostics{
+		URI:         fileURI,
+		ResultID:    strconv.FormatUint(hash.Sum64(), 16),
+		Diagnostics: diagnostics,
+	}
+}
@@ -0,0 +1,57 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestDiskDiagnosticsFollowImportedFiles(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"pets.crl":    "grim Dog:\n    spell bark():\n        return 1\n",
+		"main.crl":    "import \"pets\"\nd = Dog()\nprint(d)\n",
+		"scratch.crl": "x = 1\nprint(x)\n",
+	}, "scratch.crl")
+	if err := w.indexUnopenedFiles(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mainPath := w.path("main.crl")
+
+	// Diagnostics are requested from views, as the handler does
+	messages := func() []string {
+		t.Helper()
+		result := make([]string, 0)
+		for _, diagnostic := range w.View().DocumentDiagnostics(w.uri("main.crl")).Diagnostics {
+			result = append(result, diagnostic.Message)
+		}
+		return result
+	}
+	if got := messages(); len(got) != 0 {
+		t.Fatalf("diagnostics of main.crl = %v, want none", got)
+	}
+
+	// Break main.crl without changing its size or modification time, so that
+	// only computing its diagnostics again reveals its parse errors
+	info, err := os.Stat(mainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mainPath, []byte("import \"pets\"\nd = Dog((\nprint(d)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(mainPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editing a file main.crl does not import keeps its diagnostics
+	w.change("scratch.crl", "x = 2\nprint(x)\n")
+	if got := messages(); len(got) != 0 {
+		t.Errorf("after an unrelated edit, diagnostics of main.crl = %v, want the cached ones", got)
+	}
+
+	// Indexing the file it imports again computes them again
+	w.ReindexFile(w.uri("pets.crl"))
+	if got := messages(); len(got) == 0 {
+		t.Error("after the imported file changed, main.crl has no diagnostics, want its parse errors")
+	}
+}
@@ -0,0 +1,201 @@
+package analyzer
+
+import (
+	"sort"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// GetDocumentSymbols returns the hierarchical outline of a document
+func (a *CarrionAnalyzer) GetDocumentSymbols(uri lsp.DocumentURI) []lsp.DocumentSymbol {
+	doc := a.Document(uri)
+	if doc == nil {
+		a.logger.Warn("Cannot get document symbols for non-existent document: %s", uri)
+		return nil
+	}
+
+	fileScope, ok := a.symbolTable.FileScopes[string(uri)]
+	if !ok {
+		return nil
+	}
+
+	lines := a.newFileLines()
+	documentSymbols := make([]lsp.DocumentSymbol, 0, len(fileScope.Symbols))
+
+	for _, symbol := range fileScope.Symbols {
+		switch symbol.Type {
+		case "Grimoire":
+			documentSymbols = append(documentSymbols, grimoireDocumentSymbol(symbol, lines))
+		case "spell":
+			documentSymbols = append(documentSymbols, spellDocumentSymbol(symbol, lsp.SymbolKindFunction, lines))
+		case "variable", "instance":
+			documentSymbols = append(documentSymbols, variableDocumentSymbol(symbol, lsp.SymbolKindVariable, lines))
+		}
+	}
+
+	sortDocumentSymbols(documentSymbols)
+	return documentSymbols
+}
+
+// grimoireDocumentSymbol builds the outline entry of a Grimoire and its members
+func grimoireDocumentSymbol(symbol *symbols.Symbol, lines *fileLines) lsp.DocumentSymbol {
+	documentSymbol := lsp.DocumentSymbol{
+		Name:           symbol.Name,
+		Kind:           lsp.SymbolKindClass,
+		Range:          lines.definitionRange(symbol),
+		SelectionRange: lines.symbolNameRange(symbol),
+	}
+
+	if symbol.Scope == nil || symbol.Scope.Grimoire == nil {
+		return documentSymbol
+	}
+
+	Grimoire := symbol.Scope.Grimoire
+	if Grimoire.ParentName != "" {
+		documentSymbol.Detail = "(" + Grimoire.ParentName + ")"
+	}
+
+	for _, method := range Grimoire.Methods {
+		kind := lsp.SymbolKindMethod
+		if method.Name == "init" {
+			kind = lsp.SymbolKindConstructor
+		}
+		documentSymbol.Children = append(documentSymbol.Children, spellDocumentSymbol(method, kind, lines))
+	}
+
+	for _, field := range Grimoire.Fields {
+		documentSymbol.Children = append(documentSymbol.Children, variableDocumentSymbol(field, lsp.SymbolKindField, lines))
+	}
+
+	sortDocumentSymbols(documentSymbol.Children)
+	return documentSymbol
+}
+
+// spellDocumentSymbol builds the outline entry of a spell or method and its locals
+func spellDocumentSymbol(symbol *symbols.Symbol, kind lsp.SymbolKind, lines *fileLines) lsp.DocumentSymbol {
+	documentSymbol := lsp.DocumentSymbol{
+		Name:           symbol.Name,
+		Detail:         "(" + parameterList(symbol.Parameters) + ")",
+		Kind:           kind,
+		Range:          lines.definitionRange(symbol),
+		SelectionRange: lines.symbolNameRange(symbol),
+	}
+
+	if symbol.Scope != nil {
+		for _, local := range symbol.Scope.Symbols {
+			if local.Type == "variable" || local.Type == "instance" {
+				documentSymbol.Children = append(
+					documentSymbol.Children,
+					variableDocumentSymbol(local, lsp.SymbolKindVariable, lines),
+				)
+			}
+		}
+	}
+
+	sortDocumentSymbols(documentSymbol.Children)
+	return documentSymbol
+}
+
+// variableDocumentSymbol builds the outline entry of a variable or field
+func variableDocumentSymbol(symbol *symbols.Symbol, kind lsp.SymbolKind, lines *fileLines) lsp.DocumentSymbol {
+	detail := symbol.ValueType
+	if symbol.Type == "instance" {
+		detail = symbol.GrimoireName
+	}
+
+	selectionRange := lines.symbolNameRange(symbol)
+	return lsp.DocumentSymbol{
+		Name:           symbol.Name,
+		Detail:         detail,
+		Kind:           kind,
+		Range:          selectionRange,
+		SelectionRange: selectionRange,
+	}
+}
+
+// symbolNameSpan returns the span of the name of a symbol at its definition
+func symbolNameSpan(symbol *symbols.Symbol) symbols.Span {
+	if symbol.Declaration != nil {
+		return referenceSpan(symbol.Declaration)
+	}
+
+	return symbols.Span{
+		StartLine:   symbol.DefinitionLine,
+		StartColumn: symbol.DefinitionColumn,
+		EndLine:     symbol.DefinitionLine,
+		EndColumn:   symbol.DefinitionColumn + len(symbol.Name),
+	}
+}
+
+// symbolFullSpan returns the span of the whole definition of a symbol, from
+// its keyword to the end of the last line of its body
+func symbolFullSpan(symbol *symbols.Symbol, lines []string) symbols.Span {
+	nameSpan := symbolNameSpan(symbol)
+	if symbol.Scope == nil || symbol.Scope.EndLine < symbol.DefinitionLine {
+		return nameSpan
+	}
+
+	endLine := symbol.Scope.EndLine
+	endColumn := 0
+	if endLine < len(lines) {
+		endColumn = len(strings.TrimRight(lines[endLine], " \t\r"))
+	}
+
+	fullSpan := symbols.Span{
+		StartLine:   symbol.DefinitionLine,
+		StartColumn: symbol.DefinitionColumn,
+		EndLine:     endLine,
+		EndColumn:   endColumn,
+	}
+
+	// The name must be contained in the whole definition
+	if columnLess(nameSpan.StartLine, nameSpan.StartColumn, fullSpan.StartLine, fullSpan.StartColumn) {
+		fullSpan.StartLine, fullSpan.StartColumn = nameSpan.StartLine, nameSpan.StartColumn
+	}
+	if columnLess(fullSpan.EndLine, fullSpan.EndColumn, nameSpan.EndLine, nameSpan.EndColumn) {
+		fullSpan.EndLine, fullSpan.EndColumn = nameSpan.EndLine, nameSpan.EndColumn
+	}
+	return fullSpan
+}
+
+// parameterList formats spell parameters the way they are written in source
+func parameterList(params []symbols.Parameter) string {
+	paramStrs := make([]string, 0, len(params))
+	for _, param := range params {
+		paramStr := param.Name
+		if param.TypeHint != "" {
+			paramStr += ": " + param.TypeHint
+		}
+		if param.DefaultValue != "" {
+			paramStr += " = " + param.DefaultValue
+		}
+		paramStrs = append(paramStrs, paramStr)
+	}
+	return strings.Join(paramStrs, ", ")
+}
+
+// sortDocumentSymbols orders document symbols by their position in the file
+func sortDocumentSymbols(documentSymbols []lsp.DocumentSymbol) {
+	sort.Slice(documentSymbols, func(i, j int) bool {
+		return positionLess(documentSymbols[i].Range.Start, documentSymbols[j].Range.Start)
+	})
+}
+
+// positionLess reports whether position a comes before position b
+func positionLess(a, b lsp.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Character < b.Character
+}
+
+// columnLess reports whether the first line and column come before the second
+func columnLess(lineA, columnA, lineB, columnB int) bool {
+	if lineA != lineB {
+		return lineA < lineB
+	}
+	return columnA < columnB
+}
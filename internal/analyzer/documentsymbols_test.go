@@ -0,0 +1,44 @@
+package analyzer
+
+import (
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestDocumentSymbolRanges(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": "" +
+		"grim Caµ:\n" +
+		"    spell µs():\n" +
+		"        return \"é\"\n" +
+		"\n" +
+		"µvalue = Caµ()\n",
+	}, "test.crl")
+
+	outline := w.GetDocumentSymbols(w.uri("test.crl"))
+	if len(outline) != 2 {
+		t.Fatalf("outline = %v, want the Grimoire and the variable", outline)
+	}
+
+	// µ and é are one UTF-16 code unit but two bytes
+	grimoire := outline[0]
+	if want := (lsp.Range{Start: lsp.Position{Line: 0, Character: 5}, End: lsp.Position{Line: 0, Character: 8}}); grimoire.SelectionRange != want {
+		t.Errorf("Grimoire selection range = %v, want %v", grimoire.SelectionRange, want)
+	}
+	if want := (lsp.Range{Start: lsp.Position{Line: 0, Character: 0}, End: lsp.Position{Line: 2, Character: 18}}); grimoire.Range != want {
+		t.Errorf("Grimoire range = %v, want %v", grimoire.Range, want)
+	}
+
+	if len(grimoire.Children) != 1 {
+		t.Fatalf("Grimoire children = %v, want the method", grimoire.Children)
+	}
+	method := grimoire.Children[0]
+	if want := (lsp.Range{Start: lsp.Position{Line: 1, Character: 10}, End: lsp.Position{Line: 1, Character: 12}}); method.SelectionRange != want {
+		t.Errorf("method selection range = %v, want %v", method.SelectionRange, want)
+	}
+
+	variable := outline[1]
+	if want := (lsp.Range{Start: lsp.Position{Line: 4, Character: 0}, End: lsp.Position{Line: 4, Character: 6}}); variable.SelectionRange != want {
+		t.Errorf("variable selection range = %v, want %v", variable.SelectionRange, want)
+	}
+}
@@ -0,0 +1,283 @@
+package analyzer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// GetFoldingRanges returns the foldable blocks, docstrings, block comments and
+// import groups of a document. A positive limit caps the number of ranges,
+// keeping the outermost ones.
+func (a *CarrionAnalyzer) GetFoldingRanges(uri lsp.DocumentURI, limit int) []lsp.FoldingRange {
+	doc := a.Document(uri)
+	if doc == nil {
+		return nil
+	}
+	lines := strings.Split(doc.Text, "\n")
+
+	folds := &foldingRanges{lines: lines}
+	if program := a.parseDocument(doc.Text); program != nil {
+		folds.addImportGroups(program.Statements)
+		folds.addStatements(program.Statements)
+	}
+	folds.addCommentsAndDocstrings()
+
+	// Keep one range per start line, the largest
+	sort.Slice(folds.ranges, func(i, j int) bool {
+		if folds.ranges[i].StartLine != folds.ranges[j].StartLine {
+			return folds.ranges[i].StartLine < folds.ranges[j].StartLine
+		}
+		return folds.ranges[i].EndLine > folds.ranges[j].EndLine
+	})
+	ranges := make([]lsp.FoldingRange, 0, len(folds.ranges))
+	for _, fold := range folds.ranges {
+		if len(ranges) > 0 && ranges[len(ranges)-1].StartLine == fold.StartLine {
+			continue
+		}
+		ranges = append(ranges, fold)
+	}
+
+	if limit > 0 && len(ranges) > limit {
+		ranges = outermostFolds(ranges, limit)
+	}
+	return ranges
+}
+
+// foldingRanges collects the folding ranges of a document
+type foldingRanges struct {
+	lines  []string
+	ranges []lsp.FoldingRange
+}
+
+// add records a range spanning more than one line
+func (f *foldingRanges) add(startLine, endLine int, kind lsp.FoldingRangeKind) {
+	if startLine < 0 || endLine <= startLine {
+		return
+	}
+	f.ranges = append(f.ranges, lsp.FoldingRange{
+		StartLine: uint32(startLine),
+		EndLine:   uint32(endLine),
+		Kind:      kind,
+	})
+}
+
+// addBranches folds each branch of a compound statement from its header to
+// the line before the next branch, the last one to the end of the statement
+func (f *foldingRanges) addBranches(headers []int, endLine int) {
+	for i, header := range headers {
+		end := endLine
+		if i+1 < len(headers) {
+			end = headers[i+1] - 1
+		}
+		f.add(header, end, "")
+	}
+}
+
+// addImportGroups folds runs of imports on consecutive lines
+func (f *foldingRanges) addImportGroups(stmts []ast.Statement) {
+	start, end := -1, -1
+	for _, stmt := range stmts {
+		imp, ok := stmt.(*ast.ImportStatement)
+		if !ok {
+			f.add(start, end, lsp.ImportsFoldingRange)
+			start, end = -1, -1
+			continue
+		}
+
+		line := imp.Token.Line - 1
+		if start < 0 || line > end+1 {
+			f.add(start, end, lsp.ImportsFoldingRange)
+			start = line
+		}
+		end = symbols.LastLine(imp)
+	}
+	f.add(start, end, lsp.ImportsFoldingRange)
+}
+
+// addStatements folds the block statements among a list of statements and
+// the blocks nested in them
+func (f *foldingRanges) addStatements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		f.addStatement(stmt)
+	}
+}
+
+// addStatement folds a block statement and the blocks nested in it
+func (f *foldingRanges) addStatement(stmt ast.Statement) {
+	switch node := stmt.(type) {
+	case *ast.GrimoireDefinition:
+		f.add(node.Token.Line-1, symbols.LastLine(node), "")
+		if node.InitMethod != nil {
+			f.addStatement(node.InitMethod)
+		}
+		for _, method := range node.Methods {
+			f.addStatement(method)
+		}
+	case *ast.FunctionDefinition:
+		f.add(node.Token.Line-1, symbols.LastLine(node), "")
+		f.addBlock(node.Body)
+	case *ast.IfStatement:
+		headers := []int{node.Token.Line - 1}
+		for _, branch := range node.OtherwiseBranches {
+			headers = append(headers, branch.Token.Line-1)
+		}
+		after := symbols.LastLine(node.Consequence)
+		for _, branch := range node.OtherwiseBranches {
+			after = max(after, symbols.LastLine(branch.Consequence))
+		}
+		if header := f.blockHeader(node.Alternative, "else", after); header >= 0 {
+			headers = append(headers, header)
+		}
+		f.addBranches(headers, symbols.LastLine(node))
+
+		f.addBlock(node.Consequence)
+		for _, branch := range node.OtherwiseBranches {
+			f.addBlock(branch.Consequence)
+		}
+		f.addBlock(node.Alternative)
+	case *ast.ForStatement:
+		headers := []int{node.Token.Line - 1}
+		if header := f.blockHeader(node.Alternative, "else", symbols.LastLine(node.Body)); header >= 0 {
+			headers = append(headers, header)
+		}
+		f.addBranches(headers, symbols.LastLine(node))
+		f.addBlock(node.Body)
+		f.addBlock(node.Alternative)
+	case *ast.WhileStatement:
+		f.add(node.Token.Line-1, symbols.LastLine(node), "")
+		f.addBlock(node.Body)
+	case *ast.MatchStatement:
+		f.add(node.Token.Line-1, symbols.LastLine(node), "")
+		for _, c := range node.Cases {
+			f.add(c.Token.Line-1, symbols.LastLine(c), "")
+			f.addBlock(c.Body)
+		}
+		if node.Default != nil {
+			f.add(node.Default.Token.Line-1, symbols.LastLine(node.Default), "")
+			f.addBlock(node.Default.Body)
+		}
+	case *ast.AttemptStatement:
+		headers := []int{node.Token.Line - 1}
+		for _, ensnare := range node.EnsnareClauses {
+			headers = append(headers, ensnare.Token.Line-1)
+		}
+		after := symbols.LastLine(node.TryBlock)
+		for _, ensnare := range node.EnsnareClauses {
+			after = max(after, symbols.LastLine(ensnare.Consequence))
+		}
+		if header := f.blockHeader(node.ResolveBlock, "resolve", after); header >= 0 {
+			headers = append(headers, header)
+		}
+		f.addBranches(headers, symbols.LastLine(node))
+
+		f.addBlock(node.TryBlock)
+		for _, ensnare := range node.EnsnareClauses {
+			f.addBlock(ensnare.Consequence)
+		}
+		f.addBlock(node.ResolveBlock)
+	}
+}
+
+// addBlock folds the statements nested in a block
+func (f *foldingRanges) addBlock(block *ast.BlockStatement) {
+	if block != nil {
+		f.addStatements(block.Statements)
+	}
+}
+
+// blockHeader returns the line of the keyword introducing a block that
+// follows the given line, such as else, which the AST does not keep. It
+// returns -1 when there is no such block.
+func (f *foldingRanges) blockHeader(block *ast.BlockStatement, keyword string, after int) int {
+	if block == nil || after < 0 {
+		return -1
+	}
+
+	for line := after + 1; line < len(f.lines); line++ {
+		text := strings.TrimSpace(f.lines[line])
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, keyword+":") || strings.HasPrefix(text, keyword+" ") {
+			return line
+		}
+		return -1
+	}
+	return -1
+}
+
+// addCommentsAndDocstrings folds block comments and triple backtick
+// docstrings, which the parser does not keep
+func (f *foldingRanges) addCommentsAndDocstrings() {
+	var (
+		quote      byte
+		blockStart = -1
+		blockEnd   string
+	)
+
+	for lineNum, line := range f.lines {
+		for i := 0; i < len(line); i++ {
+			switch {
+			case blockStart >= 0:
+				if strings.HasPrefix(line[i:], blockEnd) {
+					f.add(blockStart, lineNum, lsp.CommentFoldingRange)
+					i += len(blockEnd) - 1
+					blockStart = -1
+				}
+			case quote != 0:
+				if line[i] == '\\' {
+					i++
+				} else if line[i] == quote {
+					quote = 0
+				}
+			case strings.HasPrefix(line[i:], "```"):
+				blockStart, blockEnd = lineNum, "```"
+				i += 2
+			case strings.HasPrefix(line[i:], "/*"):
+				blockStart, blockEnd = lineNum, "*/"
+				i++
+			case line[i] == '#':
+				i = len(line)
+			case line[i] == '"' || line[i] == '\'':
+				quote = line[i]
+			}
+		}
+		// Quoted strings do not span lines
+		quote = 0
+	}
+}
+
+// outermostFolds keeps the given number of ranges, preferring those nested
+// least deeply
+func outermostFolds(ranges []lsp.FoldingRange, limit int) []lsp.FoldingRange {
+	depths := make([]int, len(ranges))
+	open := make([]lsp.FoldingRange, 0)
+	for i, fold := range ranges {
+		for len(open) > 0 && open[len(open)-1].EndLine < fold.StartLine {
+			open = open[:len(open)-1]
+		}
+		depths[i] = len(open)
+		open = append(open, fold)
+	}
+
+	order := make([]int, len(ranges))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return depths[order[i]] < depths[order[j]]
+	})
+	order = order[:limit]
+	sort.Ints(order)
+
+	kept := make([]lsp.FoldingRange, 0, limit)
+	for _, i := range order {
+		kept = append(kept, ranges[i])
+	}
+	return kept
+}
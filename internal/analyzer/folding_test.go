@@ -0,0 +1,64 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+const foldingText = "" +
+	"import \"a\"\n" + // 0
+	"import \"b\"\n" + // 1
+	"/* a block\n" + // 2
+	"   comment */\n" + // 3
+	"grim Shape:\n" + // 4
+	"    ```\n" + // 5
+	"    A shape\n" + // 6
+	"    ```\n" + // 7
+	"    spell area(x):\n" + // 8
+	"        if x > 1:\n" + // 9
+	"            return 1\n" + // 10
+	"        otherwise x > 0:\n" + // 11
+	"            return 2\n" + // 12
+	"        else:\n" + // 13
+	"            return 3\n" + // 14
+	"spell count(items):\n" + // 15
+	"    for item in items:\n" + // 16
+	"        print(item)\n" // 17
+
+func TestFoldingRanges(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": foldingText}, "test.crl")
+
+	want := []lsp.FoldingRange{
+		{StartLine: 0, EndLine: 1, Kind: lsp.ImportsFoldingRange},
+		{StartLine: 2, EndLine: 3, Kind: lsp.CommentFoldingRange},
+		{StartLine: 4, EndLine: 14},
+		{StartLine: 5, EndLine: 7, Kind: lsp.CommentFoldingRange},
+		{StartLine: 8, EndLine: 14},
+		{StartLine: 9, EndLine: 10},
+		{StartLine: 11, EndLine: 12},
+		{StartLine: 13, EndLine: 14},
+		{StartLine: 15, EndLine: 17},
+		{StartLine: 16, EndLine: 17},
+	}
+	if got := w.GetFoldingRanges(w.uri("test.crl"), 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFoldingRanges = %v, want %v", got, want)
+	}
+}
+
+func TestFoldingRangeLimit(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": foldingText}, "test.crl")
+
+	// The top-level ranges come first, then those nested one level deep
+	want := []lsp.FoldingRange{
+		{StartLine: 0, EndLine: 1, Kind: lsp.ImportsFoldingRange},
+		{StartLine: 2, EndLine: 3, Kind: lsp.CommentFoldingRange},
+		{StartLine: 4, EndLine: 14},
+		{StartLine: 5, EndLine: 7, Kind: lsp.CommentFoldingRange},
+		{StartLine: 15, EndLine: 17},
+	}
+	if got := w.GetFoldingRanges(w.uri("test.crl"), 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFoldingRanges = %v, want %v", got, want)
+	}
+}
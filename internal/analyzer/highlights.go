@@ -0,0 +1,59 @@
+package analyzer
+
+import (
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// GetDocumentHighlights returns the occurrences in a document of the symbol
+// at the given position. Assignments, loop variables and parameters are
+// writes, other uses reads. Names are matched through the scope they resolve
+// in, so same-named locals of different spells are kept apart.
+func (a *CarrionAnalyzer) GetDocumentHighlights(uri lsp.DocumentURI, position lsp.Position) []lsp.DocumentHighlight {
+	doc := a.Document(uri)
+	if doc == nil {
+		a.logger.Warn("Cannot get highlights for non-existent document: %s", uri)
+		return nil
+	}
+
+	lines := strings.Split(doc.Text, "\n")
+	ref := a.symbolTable.ReferenceAt(string(uri), int(position.Line), byteColumn(lines, position))
+	if ref == nil {
+		return nil
+	}
+
+	refs := make([]*symbols.Reference, 0)
+	if symbol := a.symbolTable.SymbolForReference(ref); symbol != nil {
+		for _, r := range a.symbolTable.FindReferences(symbol, true) {
+			if r.URI == string(uri) {
+				refs = append(refs, r)
+			}
+		}
+	} else {
+		// Built-ins and unknown names have no definition to resolve through,
+		// so match their other unresolved uses by name
+		for _, r := range a.symbolTable.References[string(uri)] {
+			if r.Name == ref.Name && r.IsMember == ref.IsMember && a.symbolTable.SymbolForReference(r) == nil {
+				refs = append(refs, r)
+			}
+		}
+	}
+	sortReferences(refs)
+
+	highlights := make([]lsp.DocumentHighlight, 0, len(refs))
+	for _, r := range refs {
+		kind := lsp.DocumentHighlightKindRead
+		if r.IsWrite {
+			kind = lsp.DocumentHighlightKindWrite
+		}
+		highlights = append(highlights, lsp.DocumentHighlight{
+			Range: spanRange(referenceSpan(r), lines),
+			Kind:  kind,
+		})
+	}
+
+	return highlights
+}
@@ -0,0 +1,31 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestDocumentHighlights(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": "" +
+		"spell first(i):\n" +
+		"    s = \"é\" + str(i)\n" +
+		"    return s\n" +
+		"spell second(i):\n" +
+		"    return i\n",
+	}, "test.crl")
+
+	r := func(line, start, end uint32) lsp.Range {
+		return lsp.Range{Start: lsp.Position{Line: line, Character: start}, End: lsp.Position{Line: line, Character: end}}
+	}
+	// é is one UTF-16 code unit but two bytes
+	want := []lsp.DocumentHighlight{
+		{Range: r(0, 12, 13), Kind: lsp.DocumentHighlightKindWrite},
+		{Range: r(1, 18, 19), Kind: lsp.DocumentHighlightKindRead},
+	}
+	got := w.GetDocumentHighlights(w.uri("test.crl"), lsp.Position{Line: 1, Character: 18})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetDocumentHighlights = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,209 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// resolveImports maps the imports of a file to the files they refer to,
+// indexing imported files the symbol table does not know yet
+func (a *CarrionAnalyzer) resolveImports(docURI lsp.DocumentURI) {
+	for _, imp := range a.symbolTable.Imports[string(docURI)] {
+		path, ok := a.resolveImportPath(docURI, imp.Path)
+		if !ok {
+			imp.URI = ""
+			continue
+		}
+
+		target := uri.File(path)
+		imp.URI = string(target)
+		if _, known := a.symbolTable.FileScopes[string(target)]; known {
+			continue
+		}
+		if program, text := a.ParseFile(path); program != nil {
+			a.IndexProgram(target, program, text)
+		}
+	}
+}
+
+// resolveImportPath finds the file an import path refers to the way the
+// runtime does: it appends .crl to the path and, unless the result is
+// absolute, resolves it from the folder the program runs in.
+func (a *CarrionAnalyzer) resolveImportPath(from lsp.DocumentURI, importPath string) (string, bool) {
+	if importPath == "" {
+		return "", false
+	}
+
+	path := filepath.FromSlash(importPath) + ".crl"
+	if !filepath.IsAbs(path) {
+		root, ok := a.importRoot(from)
+		if !ok {
+			return "", false
+		}
+		path = filepath.Join(root, path)
+	}
+	return path, isFile(path)
+}
+
+// importRoot returns the folder the imports of a file are resolved from.
+// Programs are taken to run from the workspace folder holding them, or from
+// their own folder outside any workspace folder.
+func (a *CarrionAnalyzer) importRoot(from lsp.DocumentURI) (string, bool) {
+	fromPath, ok := uriToPath(from)
+	if !ok {
+		return "", false
+	}
+
+	root := ""
+	for _, folder := range a.workspaceFolders {
+		rel, err := filepath.Rel(folder, fromPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		// Nested workspace folders take precedence over their parents
+		if len(folder) > len(root) {
+			root = folder
+		}
+	}
+	if root == "" {
+		root = filepath.Dir(fromPath)
+	}
+	return root, true
+}
+
+// checkImports reports imports that do not resolve to a file
+func (a *CarrionAnalyzer) checkImports(doc *protocol.CarrionDocument) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+
+	lines := strings.Split(doc.Text, "\n")
+	for _, imp := range a.symbolTable.Imports[string(doc.URI)] {
+		if imp.URI != "" {
+			continue
+		}
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    importRange(imp, lines),
+			Severity: protocol.DiagnosticSeverity["error"],
+			Source:   "carrion-lsp",
+			Message:  fmt.Sprintf("cannot resolve import %q", imp.Path),
+		})
+	}
+
+	return diagnostics
+}
+
+// importsNeedOrganizing reports whether organizing the imports of a document
+// would change it
+func importsNeedOrganizing(a *CarrionAnalyzer, uri lsp.DocumentURI) bool {
+	_, ok := a.organizedImports(uri)
+	return ok
+}
+
+// resolveOrganizeImports sorts the imports of a document and removes the
+// duplicate and unused ones
+func resolveOrganizeImports(a *CarrionAnalyzer, data codeActionData) (*lsp.WorkspaceEdit, error) {
+	edit, ok := a.organizedImports(data.URI)
+	if !ok {
+		return &lsp.WorkspaceEdit{}, nil
+	}
+	return &lsp.WorkspaceEdit{
+		Changes: map[lsp.DocumentURI][]lsp.TextEdit{data.URI: {edit}},
+	}, nil
+}
+
+// organizedImports returns the edit rewriting the lines from the first to the
+// last import of a document with its imports sorted, without duplicate and
+// unused ones. Other statements between imports are moved after them. It
+// reports false when the imports are already organized.
+func (a *CarrionAnalyzer) organizedImports(uri lsp.DocumentURI) (lsp.TextEdit, bool) {
+	doc := a.Document(uri)
+	imports := a.symbolTable.Imports[string(uri)]
+	if doc == nil || len(imports) == 0 {
+		return lsp.TextEdit{}, false
+	}
+
+	lines := strings.Split(doc.Text, "\n")
+	importLines := make(map[int]bool)
+	first, last := len(lines), -1
+	for _, imp := range imports {
+		if imp.Line >= len(lines) {
+			return lsp.TextEdit{}, false
+		}
+		importLines[imp.Line] = true
+		if imp.Line < first {
+			first = imp.Line
+		}
+		if imp.Line > last {
+			last = imp.Line
+		}
+	}
+
+	unusedLines := make(map[int]bool)
+	for _, diagnostic := range a.checkUnusedImports(uri, lines) {
+		unusedLines[int(diagnostic.Range.Start.Line)] = true
+	}
+
+	kept := make([]string, 0, len(imports))
+	others := make([]string, 0)
+	seen := make(map[string]bool)
+	for line := first; line <= last; line++ {
+		text := strings.TrimRight(lines[line], "\r")
+		switch {
+		case importLines[line]:
+			statement := strings.TrimSpace(text)
+			if !unusedLines[line] && !seen[statement] {
+				seen[statement] = true
+				kept = append(kept, statement)
+			}
+		case strings.TrimSpace(text) != "":
+			others = append(others, text)
+		}
+	}
+	sort.Strings(kept)
+
+	current := strings.TrimRight(strings.Join(lines[first:last+1], "\n"), "\r")
+	current = strings.ReplaceAll(current, "\r\n", "\n")
+	organized := strings.Join(append(kept, others...), "\n")
+	end := spanRange(symbols.Span{StartLine: last, EndLine: last, EndColumn: len(lines[last])}, lines).End
+	if last+1 < len(lines) {
+		// Replace whole lines so that removed imports leave no blank line
+		end = lsp.Position{Line: uint32(last + 1)}
+		current += "\n"
+		if organized != "" {
+			organized += "\n"
+		}
+	}
+	if organized == current {
+		return lsp.TextEdit{}, false
+	}
+
+	return lsp.TextEdit{
+		Range:   lsp.Range{Start: lsp.Position{Line: uint32(first)}, End: end},
+		NewText: organized,
+	}, true
+}
+
+// importRange returns the range of the quoted path of an import in the lines
+// of the importing file
+func importRange(imp *symbols.Import, lines []string) lsp.Range {
+	return spanRange(symbols.Span{
+		StartLine:   imp.Line,
+		StartColumn: imp.Column,
+		EndLine:     imp.Line,
+		EndColumn:   imp.Column + len(imp.Path) + 2,
+	}, lines)
+}
+
+// isFile reports whether a regular file exists at the given path
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,68 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+const shapesFile = "grim Circle:\n" +
+	"    spell area():\n" +
+	"        return 1\n" +
+	"\n" +
+	"spell helper():\n" +
+	"    return 2\n"
+
+func TestImportWithoutAliasExposesGrimoires(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"lib/shapes.crl": shapesFile,
+		"lib/main.crl": "import \"lib/shapes\"\n" +
+			"c = Circle()\n" +
+			"helper()\n" +
+			"c.area()\n",
+	}, "lib/main.crl")
+	messages := w.messages("lib/main.crl")
+
+	want := []string{"undefined: helper"}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", messages, want)
+	}
+}
+
+func TestImportWithAliasBindsTheFile(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"lib/shapes.crl": shapesFile,
+		"main.crl": "import \"lib/shapes\" as shapes\n" +
+			"shapes.helper()\n" +
+			"Circle()\n",
+	}, "main.crl")
+	messages := w.messages("main.crl")
+
+	want := []string{"undefined: Circle"}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", messages, want)
+	}
+
+	imp := w.symbolTable.Imports[string(w.uri("main.crl"))][0]
+	for _, name := range []string{"helper", "Circle"} {
+		if w.symbolTable.ModuleMember(imp, name) == nil {
+			t.Errorf("shapes.%s is not found", name)
+		}
+	}
+}
+
+func TestImportPathIsResolvedLikeTheRuntime(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"lib/shapes.crl": shapesFile,
+		"lib/main.crl": "import \"shapes\"\n" +
+			"import \"lib/shapes.crl\"\n" +
+			"import \"lib/shapes\"\n" +
+			"Circle()\n",
+	}, "lib/main.crl")
+	messages := w.messages("lib/main.crl")
+
+	// Paths are relative to the workspace folder and always get .crl appended
+	want := []string{`cannot resolve import "shapes"`, `cannot resolve import "lib/shapes.crl"`}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diagnostics = %q, want %q", messages, want)
+	}
+}
@@ -0,0 +1,164 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// inheritanceFiles derive a Grimoire from one of another file, overriding
+// one of its spells
+var inheritanceFiles = map[string]string{
+	"animals.crl": "" +
+		"grim Animal:\n" +
+		"    spell init(name):\n" +
+		"        self.name = name\n" +
+		"    spell speak():\n" +
+		"        return self.name\n" +
+		"    spell sleep():\n" +
+		"        return 0\n",
+	"dogs.crl": "" +
+		"import \"animals\"\n" +
+		"grim Dog(Animal):\n" +
+		"    spell speak():\n" +
+		"        return super.speak()\n" +
+		"    spell fetch():\n" +
+		"        return self.name\n" +
+		"rex = Dog(\"Rex\")\n" +
+		"rex.sleep()\n",
+}
+
+// completionDetails returns the labels of completion items with their details
+func completionDetails(items []lsp.CompletionItem) []string {
+	details := make([]string, 0, len(items))
+	for _, item := range items {
+		details = append(details, item.Label+": "+item.Detail)
+	}
+	return details
+}
+
+// nameRange returns the range between two columns of a line
+func nameRange(line, start, end uint32) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: line, Character: start},
+		End:   lsp.Position{Line: line, Character: end},
+	}
+}
+
+func TestInheritedMemberCompletions(t *testing.T) {
+	w := newTestWorkspace(t, inheritanceFiles, "animals.crl", "dogs.crl")
+
+	tests := []struct {
+		name      string
+		line      uint32
+		character uint32
+		want      []string
+	}{
+		{"self", 5, 20, []string{
+			"speak: method of Dog",
+			"fetch: method of Dog",
+			"sleep: method of Animal",
+			"init: method of Animal",
+			"name: field of Animal",
+		}},
+		{"instance", 7, 4, []string{
+			"speak: speak()",
+			"fetch: fetch()",
+			"sleep: Animal.sleep()",
+			"init: Animal.init(name)",
+			"name: field of Animal",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := lsp.Position{Line: tt.line, Character: tt.character}
+			got := completionDetails(w.GetCompletions(w.uri("dogs.crl"), position))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetCompletions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInheritedMemberDefinition(t *testing.T) {
+	w := newTestWorkspace(t, inheritanceFiles, "animals.crl", "dogs.crl")
+
+	tests := []struct {
+		name      string
+		line      uint32
+		character uint32
+		want      lsp.Location
+	}{
+		{"inherited spell", 7, 5, lsp.Location{
+			URI:   w.uri("animals.crl"),
+			Range: nameRange(5, 10, 15),
+		}},
+		{"super call", 3, 22, lsp.Location{
+			URI:   w.uri("animals.crl"),
+			Range: nameRange(3, 10, 15),
+		}},
+		{"inherited field", 5, 21, lsp.Location{
+			URI:   w.uri("animals.crl"),
+			Range: nameRange(2, 13, 17),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := lsp.Position{Line: tt.line, Character: tt.character}
+			got := w.FindDefinition(w.uri("dogs.crl"), position)
+			if !reflect.DeepEqual(got, []lsp.Location{tt.want}) {
+				t.Errorf("FindDefinition = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInheritedMemberHover(t *testing.T) {
+	w := newTestWorkspace(t, inheritanceFiles, "animals.crl", "dogs.crl")
+
+	tests := []struct {
+		name      string
+		line      uint32
+		character uint32
+		want      string
+	}{
+		{"inherited spell", 7, 5, "**method** Animal.sleep()\n\n"},
+		{"super call", 3, 22, "**method** Animal.speak()\n\n"},
+		{"override", 2, 11, "**method** Dog.speak()\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hover := w.GetHoverInfo(w.uri("dogs.crl"), lsp.Position{Line: tt.line, Character: tt.character})
+			if hover == nil {
+				t.Fatal("GetHoverInfo = nil")
+			}
+			if hover.Contents.Value != tt.want {
+				t.Errorf("hover = %q, want %q", hover.Contents.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestCyclicInheritance(t *testing.T) {
+	text := "" +
+		"grim Left(Right):\n" +
+		"    spell left():\n" +
+		"        return self.right()\n" +
+		"grim Right(Left):\n" +
+		"    spell right():\n" +
+		"        return self.left()\n"
+	w := newTestWorkspace(t, map[string]string{"cycle.crl": text}, "cycle.crl")
+
+	got := completionDetails(w.GetCompletions(w.uri("cycle.crl"), lsp.Position{Line: 2, Character: 20}))
+	want := []string{"left: method of Left", "right: method of Right"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetCompletions = %q, want %q", got, want)
+	}
+
+	locations := w.FindDefinition(w.uri("cycle.crl"), lsp.Position{Line: 2, Character: 21})
+	definition := []lsp.Location{{URI: w.uri("cycle.crl"), Range: nameRange(4, 10, 15)}}
+	if !reflect.DeepEqual(locations, definition) {
+		t.Errorf("FindDefinition = %v, want %v", locations, definition)
+	}
+}
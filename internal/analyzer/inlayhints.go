@@ -0,0 +1,321 @@
+package analyzer
+
+import (
+	"strings"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// InlayHintSettings selects the kinds of inlay hints the server shows
+type InlayHintSettings struct {
+	// ParameterNames labels call arguments with the parameter they bind to
+	ParameterNames bool
+	// VariableTypes shows the inferred type of variables declared without one
+	VariableTypes bool
+}
+
+// DefaultInlayHintSettings returns the settings used until the client
+// configures inlay hints
+func DefaultInlayHintSettings() InlayHintSettings {
+	return InlayHintSettings{ParameterNames: true, VariableTypes: true}
+}
+
+// builtinReturnTypes are the types of the values built-in functions return,
+// for those returning a single type
+var builtinReturnTypes = map[string]string{
+	"int":   "int",
+	"float": "float",
+	"str":   "str",
+	"bool":  "bool",
+	"list":  "list",
+	"tuple": "tuple",
+	"len":   "int",
+	"input": "str",
+	"ord":   "int",
+	"chr":   "str",
+}
+
+// SetInlayHintSettings changes the kinds of inlay hints the server shows
+func (a *CarrionAnalyzer) SetInlayHintSettings(settings InlayHintSettings) {
+	a.inlayHints = settings
+}
+
+// InlayHintSettings returns the kinds of inlay hints the server shows
+func (a *CarrionAnalyzer) InlayHintSettings() InlayHintSettings {
+	return a.inlayHints
+}
+
+// GetInlayHints returns the hints within a range of a document: parameter
+// names before the arguments of calls to known spells, methods, Grimoires and
+// built-ins, and the inferred type after variables declared without one
+func (a *CarrionAnalyzer) GetInlayHints(uri lsp.DocumentURI, rng lsp.Range) []protocol.InlayHint {
+	doc := a.Document(uri)
+	if doc == nil {
+		a.logger.Warn("Cannot get inlay hints for non-existent document: %s", uri)
+		return nil
+	}
+	if !a.inlayHints.ParameterNames && !a.inlayHints.VariableTypes {
+		return nil
+	}
+
+	program := a.parseDocument(doc.Text)
+	if program == nil {
+		return nil
+	}
+
+	h := &inlayHintCollector{
+		a:         a,
+		uri:       uri,
+		lines:     strings.Split(doc.Text, "\n"),
+		positions: symbols.NewPositionMap(doc.Text),
+		rng:       rng,
+		hints:     make([]protocol.InlayHint, 0),
+	}
+	h.walk(program)
+	return h.hints
+}
+
+// inlayHintCollector collects the inlay hints of a document
+type inlayHintCollector struct {
+	a         *CarrionAnalyzer
+	uri       lsp.DocumentURI
+	lines     []string
+	positions *symbols.PositionMap
+	rng       lsp.Range
+	hints     []protocol.InlayHint
+}
+
+// walk adds the hints of a node and the nodes nested in it
+func (h *inlayHintCollector) walk(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.CallExpression:
+		if h.a.inlayHints.ParameterNames {
+			h.addParameterNames(n)
+		}
+	case *ast.AssignStatement:
+		if h.a.inlayHints.VariableTypes {
+			h.addVariableType(n)
+		}
+	}
+
+	for _, child := range symbols.Children(node) {
+		h.walk(child)
+	}
+}
+
+// add records a hint when it falls within the requested range
+func (h *inlayHintCollector) add(hint protocol.InlayHint) {
+	if !rangeContains(h.rng, hint.Position) {
+		return
+	}
+	h.hints = append(h.hints, hint)
+}
+
+// addParameterNames labels the arguments of a call with the names of the
+// parameters they bind to. Arguments named like their parameter are left
+// alone, as are those passed to a variadic parameter.
+func (h *inlayHintCollector) addParameterNames(call *ast.CallExpression) {
+	params := h.calleeParameters(call.Function)
+	for i, arg := range call.Arguments {
+		if i >= len(params) || strings.HasPrefix(params[i], "...") {
+			return
+		}
+		name := strings.TrimSuffix(params[i], "?")
+		if name == "" || argumentName(arg) == name {
+			continue
+		}
+
+		span := h.positions.Span(arg)
+		if !span.IsValid() {
+			continue
+		}
+		h.add(protocol.InlayHint{
+			Position:     spanRange(span, h.lines).Start,
+			Label:        name + ":",
+			Kind:         protocol.InlayHintKindParameter,
+			PaddingRight: true,
+		})
+	}
+}
+
+// calleeParameters returns the parameter names of the spell, method,
+// Grimoire or built-in a call invokes. Built-in names may end with "?" for
+// optional parameters or start with "..." for variadic ones.
+func (h *inlayHintCollector) calleeParameters(function ast.Expression) []string {
+	var ident *ast.Identifier
+	switch fn := function.(type) {
+	case *ast.Identifier:
+		ident = fn
+	case *ast.DotExpression:
+		ident = fn.Right
+	}
+	if ident == nil {
+		return nil
+	}
+
+	st := h.a.symbolTable
+	var symbol *symbols.Symbol
+	if ref := st.ReferenceAt(string(h.uri), ident.Token.Line-1, ident.Token.Column-1); ref != nil && ref.Name == ident.Value {
+		symbol = st.SymbolForReference(ref)
+	} else if _, ok := function.(*ast.Identifier); ok {
+		symbol = st.LookupSymbol(ident.Value, string(h.uri))
+	}
+
+	if symbol == nil {
+		if _, ok := function.(*ast.Identifier); !ok {
+			return nil
+		}
+		help := h.a.getBuiltinSignatureHelp(ident.Value, 0)
+		if help == nil || len(help.Signatures) == 0 {
+			return nil
+		}
+		names := make([]string, 0, len(help.Signatures[0].Parameters))
+		for _, param := range help.Signatures[0].Parameters {
+			names = append(names, param.Label)
+		}
+		return names
+	}
+
+	switch symbol.Type {
+	case "spell", "method":
+		return parameterNames(symbol.Parameters)
+	case "Grimoire":
+		if Grimoire := st.LookupGrimoire(symbol.Name); Grimoire != nil {
+			if init := st.LookupMember(Grimoire, "init"); init != nil {
+				return parameterNames(init.Parameters)
+			}
+		}
+	}
+	return nil
+}
+
+// addVariableType shows the type inferred from the value of an assignment
+// declaring a variable without a type hint
+func (h *inlayHintCollector) addVariableType(node *ast.AssignStatement) {
+	target, ok := node.Name.(*ast.Identifier)
+	if !ok || node.TypeHint != nil || node.Value == nil {
+		return
+	}
+
+	line, column := target.Token.Line-1, target.Token.Column-1
+	ref := h.a.symbolTable.ReferenceAt(string(h.uri), line, column)
+	if ref == nil || !ref.IsDeclaration || ref.Name != target.Value {
+		return
+	}
+
+	valueType := h.inferType(node.Value, ref.Scope)
+	if valueType == "" {
+		return
+	}
+	h.add(protocol.InlayHint{
+		Position: lsp.Position{
+			Line:      uint32(line),
+			Character: utf16Column(h.lines, line, column+len(target.Value)),
+		},
+		Label: ": " + valueType,
+		Kind:  protocol.InlayHintKindType,
+	})
+}
+
+// inferType returns the type of the value of an expression when it can be
+// told without running it, "" otherwise
+func (h *inlayHintCollector) inferType(expr ast.Expression, scope *symbols.Scope) string {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		return "int"
+	case *ast.FloatLiteral:
+		return "float"
+	case *ast.StringLiteral:
+		return "str"
+	case *ast.Boolean:
+		return "bool"
+	case *ast.ArrayLiteral:
+		return "list"
+	case *ast.TupleLiteral:
+		return "tuple"
+	case *ast.HashLiteral:
+		return "hash"
+	case *ast.Identifier:
+		if scope == nil {
+			return ""
+		}
+		symbol := scope.Resolve(e.Value)
+		switch {
+		case symbol == nil:
+			return ""
+		case symbol.Type == "instance":
+			return symbol.GrimoireName
+		case symbol.Type == "variable" || symbol.Type == "parameter":
+			return symbol.ValueType
+		}
+	case *ast.CallExpression:
+		return h.callType(e)
+	}
+	return ""
+}
+
+// callType returns the type of the value a call returns: the Grimoire it
+// instantiates or the type a built-in returns. Spells do not declare the type
+// they return.
+func (h *inlayHintCollector) callType(call *ast.CallExpression) string {
+	var ident *ast.Identifier
+	switch fn := call.Function.(type) {
+	case *ast.Identifier:
+		ident = fn
+	case *ast.DotExpression:
+		ident = fn.Right
+	}
+	if ident == nil {
+		return ""
+	}
+
+	st := h.a.symbolTable
+	if ref := st.ReferenceAt(string(h.uri), ident.Token.Line-1, ident.Token.Column-1); ref != nil && ref.Name == ident.Value {
+		if symbol := st.SymbolForReference(ref); symbol != nil {
+			if symbol.Type == "Grimoire" {
+				return symbol.Name
+			}
+			return ""
+		}
+	}
+
+	if _, ok := call.Function.(*ast.Identifier); !ok {
+		return ""
+	}
+	if Grimoire := st.LookupGrimoire(ident.Value); Grimoire != nil {
+		return Grimoire.Name
+	}
+	for _, item := range h.a.getBuiltinGrimoireNames() {
+		if item.Label == ident.Value {
+			return item.Label
+		}
+	}
+	return builtinReturnTypes[ident.Value]
+}
+
+// parameterNames returns the names of the given parameters
+func parameterNames(params []symbols.Parameter) []string {
+	names := make([]string, 0, len(params))
+	for _, param := range params {
+		names = append(names, param.Name)
+	}
+	return names
+}
+
+// argumentName returns the name an argument is passed by, such as x for x or
+// self.x, "" for other expressions
+func argumentName(arg ast.Expression) string {
+	switch e := arg.(type) {
+	case *ast.Identifier:
+		return e.Value
+	case *ast.DotExpression:
+		if e.Right != nil {
+			return e.Right.Value
+		}
+	}
+	return ""
+}
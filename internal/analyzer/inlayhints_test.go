@@ -0,0 +1,75 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+)
+
+const inlayHintText = "" +
+	"grim Clock:\n" + // 0
+	"    spell init(hour):\n" + // 1
+	"        self.hour = hour\n" + // 2
+	"spell add(first, second):\n" + // 3
+	"    return first + second\n" + // 4
+	"µ = len(\"x\")\n" + // 5
+	"c = Clock(µ)\n" + // 6
+	"total = add(µ, second)\n" // 7
+
+// inlayHints returns the hints of the lines from first to last, both included
+func (w *testWorkspace) inlayHints(name string, first, last uint32) []protocol.InlayHint {
+	return w.GetInlayHints(w.uri(name), lsp.Range{
+		Start: lsp.Position{Line: first},
+		End:   lsp.Position{Line: last + 1},
+	})
+}
+
+func TestInlayHints(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": inlayHintText}, "test.crl")
+
+	at := func(line, character uint32) lsp.Position {
+		return lsp.Position{Line: line, Character: character}
+	}
+	want := []protocol.InlayHint{
+		// µ is one UTF-16 code unit but two bytes
+		{Position: at(5, 1), Label: ": int", Kind: protocol.InlayHintKindType},
+		{Position: at(6, 1), Label: ": Clock", Kind: protocol.InlayHintKindType},
+		{Position: at(6, 10), Label: "hour:", Kind: protocol.InlayHintKindParameter, PaddingRight: true},
+		// The second argument is named like its parameter
+		{Position: at(7, 12), Label: "first:", Kind: protocol.InlayHintKindParameter, PaddingRight: true},
+	}
+	if got := w.inlayHints("test.crl", 0, 7); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetInlayHints = %+v, want %+v", got, want)
+	}
+
+	// Only the hints within the requested range are returned
+	if got := w.inlayHints("test.crl", 6, 6); !reflect.DeepEqual(got, want[1:3]) {
+		t.Errorf("GetInlayHints of line 6 = %+v, want %+v", got, want[1:3])
+	}
+}
+
+func TestInlayHintSettings(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": inlayHintText}, "test.crl")
+
+	tests := []struct {
+		settings InlayHintSettings
+		want     []string
+	}{
+		{InlayHintSettings{VariableTypes: true}, []string{": int", ": Clock"}},
+		{InlayHintSettings{ParameterNames: true}, []string{"hour:", "first:"}},
+		{InlayHintSettings{}, []string{}},
+	}
+	for _, tt := range tests {
+		w.SetInlayHintSettings(tt.settings)
+		labels := make([]string, 0)
+		for _, hint := range w.inlayHints("test.crl", 0, 7) {
+			labels = append(labels, hint.Label)
+		}
+		if !reflect.DeepEqual(labels, tt.want) {
+			t.Errorf("hints with %+v = %q, want %q", tt.settings, labels, tt.want)
+		}
+	}
+}
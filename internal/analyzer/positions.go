@@ -0,0 +1,117 @@
+package analyzer
+
+import (
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// spanRange converts a span in byte columns into an LSP range, whose
+// characters count UTF-16 code units
+func spanRange(span symbols.Span, lines []string) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: uint32(span.StartLine), Character: utf16Column(lines, span.StartLine, span.StartColumn)},
+		End:   lsp.Position{Line: uint32(span.EndLine), Character: utf16Column(lines, span.EndLine, span.EndColumn)},
+	}
+}
+
+// utf16Column converts a byte column of a line into UTF-16 code units
+func utf16Column(lines []string, line, column int) uint32 {
+	if line < 0 || line >= len(lines) {
+		return uint32(column)
+	}
+	text := lines[line]
+	if column > len(text) {
+		return uint32(protocol.UTF16Len(text) + column - len(text))
+	}
+	return uint32(protocol.UTF16Len(text[:column]))
+}
+
+// textEnd returns the position of the end of a text
+func textEnd(text string) lsp.Position {
+	return protocol.PositionAt(text, len(text))
+}
+
+// byteColumn converts the character of an LSP position into a byte column of
+// its line
+func byteColumn(lines []string, pos lsp.Position) int {
+	if int(pos.Line) >= len(lines) {
+		return int(pos.Character)
+	}
+	text := lines[pos.Line]
+	return protocol.OffsetAt(text, lsp.Position{Character: pos.Character})
+}
+
+// documentLines returns the lines of the content of a file, or nil when it
+// cannot be read
+func (a *CarrionAnalyzer) documentLines(uri lsp.DocumentURI) []string {
+	text, ok := a.documentText(uri)
+	if !ok {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// fileLines reads the lines of files as positions in them get converted, so
+// that the references of a symbol read each of their files once
+type fileLines struct {
+	a     *CarrionAnalyzer
+	files map[string][]string
+}
+
+// newFileLines returns an empty set of file lines
+func (a *CarrionAnalyzer) newFileLines() *fileLines {
+	return &fileLines{a: a, files: make(map[string][]string)}
+}
+
+// of returns the lines of a file
+func (f *fileLines) of(uri string) []string {
+	lines, ok := f.files[uri]
+	if !ok {
+		lines = f.a.documentLines(lsp.DocumentURI(uri))
+		f.files[uri] = lines
+	}
+	return lines
+}
+
+// referenceRange returns the range of the name of a reference, in the
+// characters of its file
+func (f *fileLines) referenceRange(ref *symbols.Reference) lsp.Range {
+	return spanRange(referenceSpan(ref), f.of(ref.URI))
+}
+
+// referenceLocation converts a symbol table reference into an LSP location
+func (f *fileLines) referenceLocation(ref *symbols.Reference) lsp.Location {
+	return lsp.Location{
+		URI:   lsp.DocumentURI(ref.URI),
+		Range: f.referenceRange(ref),
+	}
+}
+
+// symbolNameRange returns the range of the name of a symbol at its
+// definition, in the characters of the file defining it
+func (f *fileLines) symbolNameRange(symbol *symbols.Symbol) lsp.Range {
+	return spanRange(symbolNameSpan(symbol), f.of(symbol.DefinitionURI))
+}
+
+// definitionRange returns the range of the whole definition of a symbol, in
+// the characters of the file defining it
+func (f *fileLines) definitionRange(symbol *symbols.Symbol) lsp.Range {
+	lines := f.of(symbol.DefinitionURI)
+	return spanRange(symbolFullSpan(symbol, lines), lines)
+}
+
+// symbolNameRange returns the range of the name of a symbol at its
+// definition, in the characters of the file defining it
+func (a *CarrionAnalyzer) symbolNameRange(symbol *symbols.Symbol) lsp.Range {
+	return a.newFileLines().symbolNameRange(symbol)
+}
+
+// definitionRange returns the range of the whole definition of a symbol, in
+// the characters of the file defining it
+func (a *CarrionAnalyzer) definitionRange(symbol *symbols.Symbol) lsp.Range {
+	return a.newFileLines().definitionRange(symbol)
+}
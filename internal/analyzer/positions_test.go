@@ -0,0 +1,89 @@
+package analyzer
+
+import (
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// positionLines has characters taking one to four bytes and one or two UTF-16
+// code units
+var positionLines = []string{"ascii", "é = 1", "😀 x"}
+
+func TestUTF16Column(t *testing.T) {
+	tests := []struct {
+		line, column int
+		want         uint32
+	}{
+		{0, 3, 3},
+		{1, 0, 0},
+		{1, 2, 1},
+		{1, 7, 6},
+		{2, 4, 2},
+		{2, 6, 4},
+		// Past the end of a line, and on lines that are not known
+		{1, 9, 8},
+		{3, 5, 5},
+	}
+	for _, tt := range tests {
+		if got := utf16Column(positionLines, tt.line, tt.column); got != tt.want {
+			t.Errorf("utf16Column(%d, %d) = %d, want %d", tt.line, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestByteColumn(t *testing.T) {
+	tests := []struct {
+		position lsp.Position
+		want     int
+	}{
+		{lsp.Position{Line: 0, Character: 3}, 3},
+		{lsp.Position{Line: 1, Character: 1}, 2},
+		{lsp.Position{Line: 1, Character: 5}, 6},
+		{lsp.Position{Line: 2, Character: 2}, 4},
+		{lsp.Position{Line: 2, Character: 4}, 6},
+		{lsp.Position{Line: 3, Character: 5}, 5},
+	}
+	for _, tt := range tests {
+		if got := byteColumn(positionLines, tt.position); got != tt.want {
+			t.Errorf("byteColumn(%v) = %d, want %d", tt.position, got, tt.want)
+		}
+	}
+}
+
+func TestSpanRange(t *testing.T) {
+	span := symbols.Span{StartLine: 1, StartColumn: 2, EndLine: 2, EndColumn: 6}
+	want := lsp.Range{Start: lsp.Position{Line: 1, Character: 1}, End: lsp.Position{Line: 2, Character: 4}}
+	if got := spanRange(span, positionLines); got != want {
+		t.Errorf("spanRange(%v) = %v, want %v", span, got, want)
+	}
+
+	if got, want := textEnd("é\n😀"), (lsp.Position{Line: 1, Character: 2}); got != want {
+		t.Errorf("textEnd = %v, want %v", got, want)
+	}
+}
+
+func TestDefinitionAndHoverAfterNonASCIIText(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": "" +
+		"spell greet(name):\n" +
+		"    return name\n" +
+		"s = \"ééé\" + greet(\"x\")\n",
+	}, "test.crl")
+	uri := w.uri("test.crl")
+
+	// Each é is one UTF-16 code unit but two bytes, so greet starts at 12
+	position := lsp.Position{Line: 2, Character: 14}
+	want := lsp.Range{Start: lsp.Position{Line: 0, Character: 6}, End: lsp.Position{Line: 0, Character: 11}}
+	locations := w.FindDefinition(uri, position)
+	if len(locations) != 1 || locations[0].Range != want {
+		t.Errorf("FindDefinition = %v, want the name of greet at %v", locations, want)
+	}
+
+	hover := w.GetHoverInfo(uri, position)
+	want = lsp.Range{Start: lsp.Position{Line: 2, Character: 12}, End: lsp.Position{Line: 2, Character: 17}}
+	if hover == nil || hover.Range == nil || *hover.Range != want {
+		t.Fatalf("GetHoverInfo = %+v, want the call of greet at %v", hover, want)
+	}
+}
@@ -0,0 +1,345 @@
+package analyzer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// maxImportFixes caps the number of files offered to import a missing name from
+const maxImportFixes = 3
+
+// fixFromData returns the fix computed along with a diagnostic
+func fixFromData(a *CarrionAnalyzer, uri lsp.DocumentURI, diagnostic lsp.Diagnostic) []lsp.CodeAction {
+	var fix diagnosticFix
+	if err := decodeData(diagnostic.Data, &fix); err != nil || fix.Title == "" || len(fix.Edits) == 0 {
+		return nil
+	}
+
+	return []lsp.CodeAction{{
+		Title:       fix.Title,
+		Kind:        lsp.QuickFix,
+		Diagnostics: []lsp.Diagnostic{diagnostic},
+		IsPreferred: true,
+		Edit: &lsp.WorkspaceEdit{
+			Changes: map[lsp.DocumentURI][]lsp.TextEdit{uri: fix.Edits},
+		},
+	}}
+}
+
+// fixQualifyWithSelf qualifies a bare name with self when it is a member of
+// the Grimoire whose method uses it
+func fixQualifyWithSelf(a *CarrionAnalyzer, uri lsp.DocumentURI, diagnostic lsp.Diagnostic) []lsp.CodeAction {
+	ref := a.diagnosticReference(uri, diagnostic)
+	if ref == nil {
+		return nil
+	}
+
+	Grimoire := ref.Scope.EnclosingGrimoire()
+	if Grimoire == nil || a.symbolTable.LookupMember(Grimoire, ref.Name) == nil {
+		return nil
+	}
+
+	start := spanRange(referenceSpan(ref), a.documentLines(uri)).Start
+	return []lsp.CodeAction{{
+		Title:       "Use self." + ref.Name,
+		Kind:        lsp.QuickFix,
+		Diagnostics: []lsp.Diagnostic{diagnostic},
+		IsPreferred: true,
+		Edit: &lsp.WorkspaceEdit{
+			Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+				uri: {{Range: lsp.Range{Start: start, End: start}, NewText: "self."}},
+			},
+		},
+	}}
+}
+
+// refactorAddSelfParameter offers to declare self explicitly as the first
+// parameter of the method whose header is at the start of a range
+func refactorAddSelfParameter(a *CarrionAnalyzer, uri lsp.DocumentURI, rng lsp.Range) []lsp.CodeAction {
+	fileScope, ok := a.symbolTable.FileScopes[string(uri)]
+	lines := a.documentLines(uri)
+	if !ok || int(rng.Start.Line) >= len(lines) {
+		return nil
+	}
+
+	for _, symbol := range fileScope.Symbols {
+		if symbol.Type != "Grimoire" || symbol.Scope == nil || symbol.Scope.Grimoire == nil {
+			continue
+		}
+		for _, method := range symbol.Scope.Grimoire.Methods {
+			nameSpan := symbolNameSpan(method)
+			if nameSpan.StartLine != int(rng.Start.Line) {
+				continue
+			}
+
+			insert, newText, ok := selfParameterInsertion(lines[nameSpan.StartLine], nameSpan.EndColumn)
+			if !ok {
+				return nil
+			}
+			at := spanRange(symbols.Span{
+				StartLine:   nameSpan.StartLine,
+				StartColumn: insert,
+				EndLine:     nameSpan.StartLine,
+				EndColumn:   insert,
+			}, lines)
+			return []lsp.CodeAction{{
+				Title: "Add self parameter to " + method.Name,
+				Kind:  lsp.RefactorRewrite,
+				Edit: &lsp.WorkspaceEdit{
+					Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+						uri: {{Range: at, NewText: newText}},
+					},
+				},
+			}}
+		}
+	}
+	return nil
+}
+
+// selfParameterInsertion returns where and what to insert in the header of a
+// method, whose name ends at the given column, to make self its first
+// parameter. It reports false when self already comes first.
+func selfParameterInsertion(line string, nameEnd int) (int, string, bool) {
+	open := nameEnd
+	for open < len(line) && line[open] == ' ' {
+		open++
+	}
+	if open >= len(line) || line[open] != '(' {
+		return 0, "", false
+	}
+
+	params := line[open+1:]
+	first := params
+	if end := strings.IndexAny(params, ",)"); end >= 0 {
+		first = params[:end]
+	}
+	switch strings.TrimSpace(first) {
+	case "self":
+		return 0, "", false
+	case "":
+		return open + 1, "self", true
+	}
+	return open + 1, "self, ", true
+}
+
+// fixImportSymbol offers to import a missing Grimoire from the workspace
+// files that define it, as an import without an alias only makes the
+// Grimoires of a file visible
+func fixImportSymbol(a *CarrionAnalyzer, uri lsp.DocumentURI, diagnostic lsp.Diagnostic) []lsp.CodeAction {
+	ref := a.diagnosticReference(uri, diagnostic)
+	if ref == nil {
+		return nil
+	}
+
+	targets := make([]string, 0)
+	for fileURI, fileScope := range a.symbolTable.FileScopes {
+		if fileURI == string(uri) {
+			continue
+		}
+		if symbol, ok := fileScope.Symbols[ref.Name]; ok && symbol.Type == "Grimoire" {
+			targets = append(targets, fileURI)
+		}
+	}
+	sort.Strings(targets)
+	if len(targets) > maxImportFixes {
+		targets = targets[:maxImportFixes]
+	}
+
+	actions := make([]lsp.CodeAction, 0, len(targets))
+	for _, target := range targets {
+		importPath, ok := a.relativeImportPath(uri, lsp.DocumentURI(target))
+		if !ok {
+			continue
+		}
+		action, ok := a.lazyAction(
+			fmt.Sprintf("Import %s from %q", ref.Name, importPath),
+			lsp.QuickFix,
+			[]lsp.Diagnostic{diagnostic},
+			codeActionData{URI: uri, Action: "importSymbol", Name: ref.Name, Target: target},
+		)
+		if ok {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// resolveImportSymbol adds an import of the target file after the existing imports
+func resolveImportSymbol(a *CarrionAnalyzer, data codeActionData) (*lsp.WorkspaceEdit, error) {
+	importPath, ok := a.relativeImportPath(data.URI, lsp.DocumentURI(data.Target))
+	if !ok {
+		return nil, fmt.Errorf("cannot import %s from %s", data.Name, data.Target)
+	}
+
+	line := 0
+	for _, imp := range a.symbolTable.Imports[string(data.URI)] {
+		if imp.Line+1 > line {
+			line = imp.Line + 1
+		}
+	}
+
+	insertAt := lsp.Position{Line: uint32(line)}
+	return &lsp.WorkspaceEdit{
+		Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+			data.URI: {{
+				Range:   lsp.Range{Start: insertAt, End: insertAt},
+				NewText: fmt.Sprintf("import %q\n", importPath),
+			}},
+		},
+	}, nil
+}
+
+// fixCreateSpell offers to define a spell that is called but does not exist
+func fixCreateSpell(a *CarrionAnalyzer, uri lsp.DocumentURI, diagnostic lsp.Diagnostic) []lsp.CodeAction {
+	ref := a.diagnosticReference(uri, diagnostic)
+	if ref == nil || !isSpellName(ref.Name) {
+		return nil
+	}
+
+	doc := a.Document(uri)
+	if doc == nil {
+		return nil
+	}
+	if _, ok := callArguments(doc.Text, ref); !ok {
+		return nil
+	}
+
+	action, ok := a.lazyAction(
+		fmt.Sprintf("Create spell %s", ref.Name),
+		lsp.QuickFix,
+		[]lsp.Diagnostic{diagnostic},
+		codeActionData{
+			URI:      uri,
+			Action:   "createSpell",
+			Name:     ref.Name,
+			Position: spanRange(referenceSpan(ref), strings.Split(doc.Text, "\n")).Start,
+		},
+	)
+	if !ok {
+		return nil
+	}
+	return []lsp.CodeAction{action}
+}
+
+// resolveCreateSpell appends a stub spell taking as many parameters as the
+// call passes arguments
+func resolveCreateSpell(a *CarrionAnalyzer, data codeActionData) (*lsp.WorkspaceEdit, error) {
+	doc := a.Document(data.URI)
+	if doc == nil {
+		return nil, fmt.Errorf("document %s is not open", data.URI)
+	}
+
+	column := byteColumn(strings.Split(doc.Text, "\n"), data.Position)
+	ref := a.symbolTable.ReferenceAt(string(data.URI), int(data.Position.Line), column)
+	if ref == nil || ref.Name != data.Name {
+		return nil, fmt.Errorf("call of %s not found", data.Name)
+	}
+	argCount, ok := callArguments(doc.Text, ref)
+	if !ok {
+		return nil, fmt.Errorf("call of %s not found", data.Name)
+	}
+
+	params := make([]string, 0, argCount)
+	for i := 1; i <= argCount; i++ {
+		params = append(params, fmt.Sprintf("arg%d", i))
+	}
+
+	newText := fmt.Sprintf("\nspell %s(%s):\n    ignore\n", data.Name, strings.Join(params, ", "))
+	if !strings.HasSuffix(doc.Text, "\n") {
+		newText = "\n" + newText
+	}
+
+	end := textEnd(doc.Text)
+	return &lsp.WorkspaceEdit{
+		Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+			data.URI: {{Range: lsp.Range{Start: end, End: end}, NewText: newText}},
+		},
+	}, nil
+}
+
+// diagnosticReference returns the name reference a diagnostic was reported on
+func (a *CarrionAnalyzer) diagnosticReference(uri lsp.DocumentURI, diagnostic lsp.Diagnostic) *symbols.Reference {
+	start := diagnostic.Range.Start
+	ref := a.symbolTable.ReferenceAt(string(uri), int(start.Line), byteColumn(a.documentLines(uri), start))
+	if ref == nil || ref.IsDeclaration || ref.IsMember {
+		return nil
+	}
+	return ref
+}
+
+// callArguments counts the arguments of the call whose callee is the given
+// reference. It reports false when the name is not followed by a call.
+func callArguments(text string, ref *symbols.Reference) (int, bool) {
+	lines := strings.Split(text, "\n")
+	if ref.Line >= len(lines) {
+		return 0, false
+	}
+
+	line := lines[ref.Line]
+	open := ref.Column + len(ref.Name)
+	for open < len(line) && line[open] == ' ' {
+		open++
+	}
+	if open >= len(line) || line[open] != '(' {
+		return 0, false
+	}
+
+	args := 0
+	depth := 0
+	var quote byte
+	for i := open + 1; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			if depth == 0 {
+				if strings.TrimSpace(line[open+1:i]) != "" {
+					args++
+				}
+				return args, true
+			}
+			depth--
+		case c == ',' && depth == 0:
+			args++
+		}
+	}
+	return args + 1, true
+}
+
+// isSpellName reports whether a name follows the spell naming convention
+// rather than the capitalized Grimoire one
+func isSpellName(name string) bool {
+	return name != "" && !(name[0] >= 'A' && name[0] <= 'Z')
+}
+
+// relativeImportPath returns the path importing one file from another, as
+// resolveImportPath resolves it
+func (a *CarrionAnalyzer) relativeImportPath(from, target lsp.DocumentURI) (string, bool) {
+	root, ok := a.importRoot(from)
+	if !ok {
+		return "", false
+	}
+	targetPath, ok := uriToPath(target)
+	if !ok {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(root, targetPath)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(strings.TrimSuffix(rel, ".crl")), true
+}
@@ -0,0 +1,79 @@
+package analyzer
+
+import (
+	"context"
+	"sort"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// FindReferences returns the locations of every use of the symbol at the
+// given position. It returns nil once ctx is cancelled.
+func (a *CarrionAnalyzer) FindReferences(
+	ctx context.Context,
+	uri lsp.DocumentURI,
+	position lsp.Position,
+	includeDeclaration bool,
+) []lsp.Location {
+	doc := a.Document(uri)
+	if doc == nil {
+		a.logger.Warn("Cannot find references in non-existent document: %s", uri)
+		return nil
+	}
+
+	symbol := a.symbolAtPosition(uri, position)
+	if symbol == nil {
+		return nil
+	}
+
+	refs := a.symbolTable.FindReferences(symbol, includeDeclaration)
+	if ctx.Err() != nil {
+		return nil
+	}
+	sortReferences(refs)
+
+	lines := a.newFileLines()
+	locations := make([]lsp.Location, 0, len(refs))
+	for _, ref := range refs {
+		locations = append(locations, lines.referenceLocation(ref))
+	}
+
+	return locations
+}
+
+// symbolAtPosition resolves the symbol whose name is at a position of a file
+// through the scope chain. The file need not be open, as for the items of a
+// hierarchy returned earlier.
+func (a *CarrionAnalyzer) symbolAtPosition(uri lsp.DocumentURI, position lsp.Position) *symbols.Symbol {
+	lines := a.documentLines(uri)
+	ref := a.symbolTable.ReferenceAt(string(uri), int(position.Line), byteColumn(lines, position))
+	if ref == nil {
+		return nil
+	}
+	return a.symbolTable.SymbolForReference(ref)
+}
+
+// referenceSpan returns the span of the name of a reference, in byte columns
+func referenceSpan(ref *symbols.Reference) symbols.Span {
+	return symbols.Span{
+		StartLine:   ref.Line,
+		StartColumn: ref.Column,
+		EndLine:     ref.Line,
+		EndColumn:   ref.Column + len(ref.Name),
+	}
+}
+
+// sortReferences orders references by file and position
+func sortReferences(refs []*symbols.Reference) {
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].URI != refs[j].URI {
+			return refs[i].URI < refs[j].URI
+		}
+		if refs[i].Line != refs[j].Line {
+			return refs[i].Line < refs[j].Line
+		}
+		return refs[i].Column < refs[j].Column
+	})
+}
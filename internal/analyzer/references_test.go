@@ -0,0 +1,49 @@
+package analyzer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestFindReferences(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"test.crl": "value = 1\ns = \"ééé\" + str(value)\n",
+	}, "test.crl")
+	uri := w.uri("test.crl")
+
+	declaration := lsp.Location{URI: uri, Range: lsp.Range{
+		Start: lsp.Position{Line: 0, Character: 0},
+		End:   lsp.Position{Line: 0, Character: 5},
+	}}
+	// Each é is one UTF-16 code unit but two bytes
+	use := lsp.Location{URI: uri, Range: lsp.Range{
+		Start: lsp.Position{Line: 1, Character: 16},
+		End:   lsp.Position{Line: 1, Character: 21},
+	}}
+
+	tests := []struct {
+		name               string
+		position           lsp.Position
+		includeDeclaration bool
+		want               []lsp.Location
+	}{
+		{"use with declaration", lsp.Position{Line: 1, Character: 18}, true, []lsp.Location{declaration, use}},
+		{"use without declaration", lsp.Position{Line: 1, Character: 18}, false, []lsp.Location{use}},
+		{"declaration", lsp.Position{Line: 0, Character: 2}, true, []lsp.Location{declaration, use}},
+		{"inside the string", lsp.Position{Line: 1, Character: 6}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := w.FindReferences(context.Background(), uri, tt.position, tt.includeDeclaration)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindReferences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
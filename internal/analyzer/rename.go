@@ -0,0 +1,228 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"unicode"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// PrepareRename checks that the symbol at the given position can be renamed
+// and returns the range of its name
+func (a *CarrionAnalyzer) PrepareRename(uri lsp.DocumentURI, position lsp.Position) (*lsp.Range, error) {
+	doc := a.Document(uri)
+	if doc == nil {
+		a.logger.Warn("Cannot prepare rename in non-existent document: %s", uri)
+		return nil, nil
+	}
+
+	ref, _, err := a.renameTarget(uri, position)
+	if err != nil || ref == nil {
+		return nil, err
+	}
+
+	symbolRange := spanRange(referenceSpan(ref), a.documentLines(uri))
+	return &symbolRange, nil
+}
+
+// Rename returns the edits renaming the symbol at the given position in every
+// open and on-disk file, along with warnings about names it collides with. It
+// fails with the error of ctx once ctx is cancelled.
+func (a *CarrionAnalyzer) Rename(
+	ctx context.Context,
+	uri lsp.DocumentURI,
+	position lsp.Position,
+	newName string,
+) (*lsp.WorkspaceEdit, []string, error) {
+	doc := a.Document(uri)
+	if doc == nil {
+		return nil, nil, fmt.Errorf("document not found: %s", uri)
+	}
+
+	if !isValidIdentifier(newName) {
+		return nil, nil, fmt.Errorf("%q is not a valid identifier", newName)
+	}
+	if isCarrionKeyword(newName) {
+		return nil, nil, fmt.Errorf("%q is a keyword", newName)
+	}
+
+	// References may live in files that were never opened
+	if err := a.indexUnopenedFiles(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	ref, symbol, err := a.renameTarget(uri, position)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ref == nil {
+		return nil, nil, fmt.Errorf("no symbol to rename at this position")
+	}
+	if newName == symbol.Name {
+		return nil, nil, nil
+	}
+
+	refs, skipped := renamableReferences(a.symbolTable.FindReferences(symbol, true))
+	warnings := a.renameConflicts(symbol, refs, newName)
+	if skipped > 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"%d uses of %q on objects of unknown type were left unchanged",
+			skipped,
+			symbol.Name,
+		))
+	}
+
+	lines := a.newFileLines()
+	changes := make(map[lsp.DocumentURI][]lsp.TextEdit)
+	for _, r := range refs {
+		fileURI := lsp.DocumentURI(r.URI)
+		changes[fileURI] = append(changes[fileURI], lsp.TextEdit{
+			Range:   lines.referenceRange(r),
+			NewText: newName,
+		})
+	}
+
+	return &lsp.WorkspaceEdit{Changes: changes}, warnings, nil
+}
+
+// renamableReferences drops the member references whose receiver has an
+// unknown type from the references of a symbol, as they may name a member of
+// an unrelated Grimoire. It returns the kept references and the number of
+// dropped ones.
+func renamableReferences(refs []*symbols.Reference) ([]*symbols.Reference, int) {
+	kept := make([]*symbols.Reference, 0, len(refs))
+	for _, ref := range refs {
+		if ref.IsMember && ref.Receiver == "" {
+			continue
+		}
+		kept = append(kept, ref)
+	}
+	return kept, len(refs) - len(kept)
+}
+
+// renameTarget returns the reference under the cursor and the symbol it
+// refers to, or an error when that symbol cannot be renamed
+func (a *CarrionAnalyzer) renameTarget(
+	uri lsp.DocumentURI,
+	position lsp.Position,
+) (*symbols.Reference, *symbols.Symbol, error) {
+	lines := a.documentLines(uri)
+	column := byteColumn(lines, position)
+	ref := a.symbolTable.ReferenceAt(string(uri), int(position.Line), column)
+	if ref == nil {
+		if word := wordAt(lines, int(position.Line), column); isCarrionKeyword(word) {
+			return nil, nil, fmt.Errorf("cannot rename keyword %q", word)
+		}
+		return nil, nil, nil
+	}
+
+	if isCarrionKeyword(ref.Name) {
+		return nil, nil, fmt.Errorf("cannot rename keyword %q", ref.Name)
+	}
+
+	symbol := a.symbolTable.SymbolForReference(ref)
+	if symbol == nil {
+		if a.isBuiltinName(ref.Name) {
+			return nil, nil, fmt.Errorf("cannot rename built-in %q", ref.Name)
+		}
+		return nil, nil, fmt.Errorf("cannot find the definition of %q", ref.Name)
+	}
+
+	return ref, symbol, nil
+}
+
+// renameConflicts describes existing symbols that the new name would clash
+// with or shadow
+func (a *CarrionAnalyzer) renameConflicts(
+	symbol *symbols.Symbol,
+	refs []*symbols.Reference,
+	newName string,
+) []string {
+	warnings := make([]string, 0)
+	seen := make(map[*symbols.Symbol]bool)
+	addConflict := func(other *symbols.Symbol) {
+		if other == nil || other == symbol || seen[other] {
+			return
+		}
+		seen[other] = true
+		warnings = append(warnings, fmt.Sprintf(
+			"%q already names a %s defined at line %d",
+			newName,
+			other.Type,
+			other.DefinitionLine+1,
+		))
+	}
+
+	if symbol.Type == "method" || symbol.Type == "field" {
+		if Grimoire := a.symbolTable.LookupGrimoire(symbol.GrimoireName); Grimoire != nil {
+			addConflict(a.symbolTable.LookupMember(Grimoire, newName))
+		}
+		return warnings
+	}
+
+	for _, ref := range refs {
+		if !ref.IsMember {
+			addConflict(ref.Scope.Resolve(newName))
+		}
+	}
+	addConflict(a.symbolTable.LookupGlobalSymbol(newName, symbol.DefinitionURI))
+
+	if a.isBuiltinName(newName) {
+		warnings = append(warnings, fmt.Sprintf("%q shadows a built-in", newName))
+	}
+
+	return warnings
+}
+
+// isBuiltinName reports whether name is a built-in function or Grimoire
+func (a *CarrionAnalyzer) isBuiltinName(name string) bool {
+	return a.builtinNames()[name]
+}
+
+// isValidIdentifier reports whether the lexer reads name as a single
+// identifier. The lexer classifies bytes rather than runes, so a non-ASCII
+// name is only valid when each of its bytes is a letter in Latin-1, as in µx.
+func isValidIdentifier(name string) bool {
+	// A lone underscore is the wildcard token
+	if name == "" || name == "_" || !isLexerLetter(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isLexerLetter(name[i]) && !unicode.IsDigit(rune(name[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLexerLetter reports whether the lexer accepts a byte as a letter of an
+// identifier
+func isLexerLetter(ch byte) bool {
+	return unicode.IsLetter(rune(ch)) || ch == '_'
+}
+
+// wordAt returns the identifier at a byte column of a line
+func wordAt(lines []string, lineNumber, column int) string {
+	if lineNumber >= len(lines) {
+		return ""
+	}
+
+	line := lines[lineNumber]
+	charPos := column
+	if charPos > len(line) {
+		charPos = len(line)
+	}
+
+	start := charPos
+	for start > 0 && isIdentifierChar(line[start-1]) {
+		start--
+	}
+	end := charPos
+	for end < len(line) && isIdentifierChar(line[end]) {
+		end++
+	}
+	return line[start:end]
+}
@@ -0,0 +1,97 @@
+package analyzer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestIsValidIdentifier(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"speak", true},
+		{"_private", true},
+		{"x2", true},
+		{"µx", true},
+		{"", false},
+		{"_", false},
+		{"2x", false},
+		{"my-name", false},
+		{"café", false},
+	}
+
+	for _, tt := range tests {
+		if got := isValidIdentifier(tt.name); got != tt.valid {
+			t.Errorf("isValidIdentifier(%q) = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
+
+func TestRenameSkipsUnknownReceivers(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"pets.crl": "" +
+		"grim Dog:\n" +
+		"    spell speak():\n" +
+		"        return \"woof\"\n" +
+		"\n" +
+		"grim Cat:\n" +
+		"    spell speak():\n" +
+		"        return \"meow\"\n" +
+		"\n" +
+		"spell talk(pet):\n" +
+		"    return pet.speak()\n" +
+		"\n" +
+		"d = Dog()\n" +
+		"d.speak()\n",
+	}, "pets.crl")
+	uri := w.uri("pets.crl")
+
+	edit, warnings, err := w.Rename(context.Background(), uri, lsp.Position{Line: 1, Character: 11}, "bark")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(map[uint32]bool)
+	for _, e := range edit.Changes[uri] {
+		lines[e.Range.Start.Line] = true
+	}
+	if len(lines) != 2 || !lines[1] || !lines[12] {
+		t.Errorf("renamed lines = %v, want the definition on line 1 and the call on line 12", lines)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %v, want one about the use on an unknown type", warnings)
+	}
+}
+
+func TestRenameAfterNonASCIIText(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"test.crl": "value = 1\ns = \"ééé\" + str(value)\n",
+	}, "test.crl")
+	uri := w.uri("test.crl")
+	position := lsp.Position{Line: 1, Character: 18}
+
+	// Each é is one UTF-16 code unit but two bytes
+	use := lsp.Range{Start: lsp.Position{Line: 1, Character: 16}, End: lsp.Position{Line: 1, Character: 21}}
+	prepared, err := w.PrepareRename(uri, position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prepared == nil || *prepared != use {
+		t.Errorf("PrepareRename = %v, want %v", prepared, use)
+	}
+
+	edit, _, err := w.Rename(context.Background(), uri, position, "total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []lsp.TextEdit{
+		{Range: lsp.Range{Start: lsp.Position{Line: 0, Character: 0}, End: lsp.Position{Line: 0, Character: 5}}, NewText: "total"},
+		{Range: use, NewText: "total"},
+	}
+	if !reflect.DeepEqual(edit.Changes[uri], want) {
+		t.Errorf("Rename edits = %v, want %v", edit.Changes[uri], want)
+	}
+}
@@ -0,0 +1,56 @@
+package analyzer
+
+import (
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// GetSelectionRanges returns, for each position, the ranges of the nodes
+// containing it from the innermost outwards, ending with the whole document
+func (a *CarrionAnalyzer) GetSelectionRanges(uri lsp.DocumentURI, positions []lsp.Position) []lsp.SelectionRange {
+	doc := a.Document(uri)
+	if doc == nil {
+		return nil
+	}
+
+	lines := strings.Split(doc.Text, "\n")
+	program := a.parseDocument(doc.Text)
+	positionMap := symbols.NewPositionMap(doc.Text)
+	document := lsp.Range{End: textEnd(doc.Text)}
+
+	selections := make([]lsp.SelectionRange, 0, len(positions))
+	for _, pos := range positions {
+		ranges := make([]lsp.Range, 0)
+		if program != nil {
+			for _, node := range positionMap.NodeAt(program, int(pos.Line), byteColumn(lines, pos)) {
+				ranges = append(ranges, spanRange(positionMap.Span(node), lines))
+			}
+		}
+		ranges = append(ranges, document)
+
+		// Build the chain from the outermost range in, skipping repeats
+		var selection *lsp.SelectionRange
+		for i := len(ranges) - 1; i >= 0; i-- {
+			if selection != nil && selection.Range == ranges[i] {
+				continue
+			}
+			selection = &lsp.SelectionRange{Range: ranges[i], Parent: selection}
+		}
+		if !rangeContains(selection.Range, pos) {
+			// Positions outside every node select nothing beyond themselves
+			selection = &lsp.SelectionRange{Range: lsp.Range{Start: pos, End: pos}, Parent: selection}
+		}
+		selections = append(selections, *selection)
+	}
+
+	return selections
+}
+
+// rangeContains reports whether a position falls within a range, its end
+// included
+func rangeContains(rng lsp.Range, pos lsp.Position) bool {
+	return !positionLess(pos, rng.Start) && !positionLess(rng.End, pos)
+}
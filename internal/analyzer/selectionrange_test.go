@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestSelectionRangeNesting(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": "" +
+		"grim Shape:\n" +
+		"    spell area(µ, x):\n" +
+		"        return µ + str(x)\n",
+	}, "test.crl")
+
+	// µ is one UTF-16 code unit but two bytes
+	r := func(startLine, startCharacter, endLine, endCharacter uint32) lsp.Range {
+		return lsp.Range{
+			Start: lsp.Position{Line: startLine, Character: startCharacter},
+			End:   lsp.Position{Line: endLine, Character: endCharacter},
+		}
+	}
+	want := []lsp.Range{
+		r(2, 23, 2, 24), // x
+		r(2, 19, 2, 25), // str(x)
+		r(2, 15, 2, 25), // µ + str(x)
+		r(2, 8, 2, 25),  // the return statement
+		r(1, 4, 2, 25),  // the spell
+		r(0, 0, 2, 25),  // the Grimoire
+		r(0, 0, 3, 0),   // the document
+	}
+
+	selections := w.GetSelectionRanges(w.uri("test.crl"), []lsp.Position{
+		{Line: 2, Character: 23},
+		{Line: 3, Character: 0},
+	})
+	if len(selections) != 2 {
+		t.Fatalf("selections = %v, want one per position", selections)
+	}
+	got := make([]lsp.Range, 0)
+	for s := &selections[0]; s != nil; s = s.Parent {
+		got = append(got, s.Range)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selection ranges = %v, want %v", got, want)
+	}
+
+	// Past the last node, only the document contains the position
+	if end := selections[1]; end.Range != r(0, 0, 3, 0) || end.Parent != nil {
+		t.Errorf("selection at the end = %+v, want the document", end)
+	}
+}
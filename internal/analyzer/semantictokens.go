@@ -0,0 +1,406 @@
+package analyzer
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// semanticTokenTypes is the token type legend; a token's type is its index
+var semanticTokenTypes = []lsp.SemanticTokenTypes{
+	lsp.SemanticTokenNamespace,
+	lsp.SemanticTokenClass,
+	lsp.SemanticTokenFunction,
+	lsp.SemanticTokenMethod,
+	lsp.SemanticTokenParameter,
+	lsp.SemanticTokenVariable,
+	lsp.SemanticTokenProperty,
+}
+
+// semanticTokenModifiers is the token modifier legend; a token's modifiers
+// are a bit set of indexes
+var semanticTokenModifiers = []lsp.SemanticTokenModifiers{
+	lsp.SemanticTokenModifierDeclaration,
+	lsp.SemanticTokenModifierReadonly,
+	lsp.SemanticTokenModifierAbstract,
+	lsp.SemanticTokenModifierStatic,
+	lsp.SemanticTokenModifierDefaultLibrary,
+}
+
+// semanticToken is a classified name in absolute LSP coordinates
+type semanticToken struct {
+	line      uint32
+	character uint32
+	length    uint32
+	tokenType int
+	modifiers int
+}
+
+// semanticTokensResult is the last full result sent for a document, kept so
+// that the next request can be answered with a delta
+type semanticTokensResult struct {
+	resultID string
+	data     []uint32
+}
+
+// semanticTokensCache holds the last semantic tokens sent per document. It is
+// shared by the views of an analyzer and token requests may run concurrently,
+// so it has its own lock.
+type semanticTokensCache struct {
+	mu      sync.Mutex
+	results map[lsp.DocumentURI]semanticTokensResult
+	seq     uint64
+}
+
+// SemanticTokensLegend returns the token types and modifiers the analyzer uses
+func SemanticTokensLegend() lsp.SemanticTokensLegend {
+	return lsp.SemanticTokensLegend{
+		TokenTypes:     semanticTokenTypes,
+		TokenModifiers: semanticTokenModifiers,
+	}
+}
+
+// GetSemanticTokens returns the semantic tokens of a whole document
+func (a *CarrionAnalyzer) GetSemanticTokens(uri lsp.DocumentURI) *lsp.SemanticTokens {
+	data := encodeSemanticTokens(a.semanticTokens(uri, nil))
+	return &lsp.SemanticTokens{
+		ResultID: a.storeSemanticTokens(uri, data),
+		Data:     data,
+	}
+}
+
+// GetSemanticTokensDelta returns the edits turning a previous result into the
+// current tokens of a document, or the full tokens when the previous result
+// is no longer known
+func (a *CarrionAnalyzer) GetSemanticTokensDelta(uri lsp.DocumentURI, previousResultID string) interface{} {
+	data := encodeSemanticTokens(a.semanticTokens(uri, nil))
+
+	// The previous result is looked up and replaced under one lock, so that
+	// of concurrent requests naming it only one gets a delta against it
+	cache := a.semanticTokensCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	previous, ok := cache.results[uri]
+	resultID := cache.store(uri, data)
+	if !ok || previous.resultID != previousResultID {
+		return &lsp.SemanticTokens{ResultID: resultID, Data: data}
+	}
+
+	delta := &lsp.SemanticTokensDelta{
+		ResultID: resultID,
+		Edits:    []lsp.SemanticTokensEdit{},
+	}
+	if edit, changed := semanticTokensEdit(previous.data, data); changed {
+		delta.Edits = append(delta.Edits, edit)
+	}
+	return delta
+}
+
+// GetSemanticTokensRange returns the semantic tokens within a range of a
+// document
+func (a *CarrionAnalyzer) GetSemanticTokensRange(uri lsp.DocumentURI, rng lsp.Range) *lsp.SemanticTokens {
+	return &lsp.SemanticTokens{
+		Data: encodeSemanticTokens(a.semanticTokens(uri, &rng)),
+	}
+}
+
+// DiscardSemanticTokens forgets the last result sent for a closed document
+func (a *CarrionAnalyzer) DiscardSemanticTokens(uri lsp.DocumentURI) {
+	a.semanticTokensCache.mu.Lock()
+	defer a.semanticTokensCache.mu.Unlock()
+	delete(a.semanticTokensCache.results, uri)
+}
+
+// storeSemanticTokens remembers the tokens sent for a document and returns
+// the result id identifying them
+func (a *CarrionAnalyzer) storeSemanticTokens(uri lsp.DocumentURI, data []uint32) string {
+	cache := a.semanticTokensCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.store(uri, data)
+}
+
+// store remembers the tokens sent for a document and returns the result id
+// identifying them. The caller holds the lock of the cache.
+func (c *semanticTokensCache) store(uri lsp.DocumentURI, data []uint32) string {
+	c.seq++
+	resultID := strconv.FormatUint(c.seq, 10)
+	c.results[uri] = semanticTokensResult{resultID: resultID, data: data}
+	return resultID
+}
+
+// tokenClassifier classifies the names of one document
+type tokenClassifier struct {
+	analyzer         *CarrionAnalyzer
+	lines            []string
+	builtinFunctions map[string]bool
+	builtinGrimoires map[string]bool
+	// arcane caches whether Grimoires and methods are abstract, as that is
+	// read from the source of their declaration
+	arcane map[*symbols.Symbol]bool
+}
+
+// semanticTokens classifies the names of a document, limited to a range when
+// one is given. Names come from the references recorded by the symbol table
+// for the last version of the document that parsed.
+func (a *CarrionAnalyzer) semanticTokens(uri lsp.DocumentURI, rng *lsp.Range) []semanticToken {
+	doc := a.Document(uri)
+	if doc == nil {
+		return nil
+	}
+
+	classifier := &tokenClassifier{
+		analyzer:         a,
+		lines:            strings.Split(doc.Text, "\n"),
+		builtinFunctions: make(map[string]bool),
+		builtinGrimoires: make(map[string]bool),
+		arcane:           make(map[*symbols.Symbol]bool),
+	}
+	for _, item := range a.getBuiltinCompletions() {
+		classifier.builtinFunctions[item.Label] = true
+	}
+	for _, item := range a.getBuiltinGrimoireNames() {
+		classifier.builtinGrimoires[item.Label] = true
+	}
+
+	tokens := make([]semanticToken, 0)
+	seen := make(map[lsp.Position]bool)
+	for _, ref := range a.symbolTable.References[string(uri)] {
+		if rng != nil && (ref.Line < int(rng.Start.Line) || ref.Line > int(rng.End.Line)) {
+			continue
+		}
+		// Skip references left over from an edit that no longer parses
+		if ref.Line >= len(classifier.lines) {
+			continue
+		}
+		line := classifier.lines[ref.Line]
+		if ref.Column > len(line) || !strings.HasPrefix(line[ref.Column:], ref.Name) {
+			continue
+		}
+
+		tokenType, modifiers, ok := classifier.classify(ref)
+		if !ok {
+			continue
+		}
+
+		nameRange := spanRange(referenceSpan(ref), classifier.lines)
+		token := semanticToken{
+			line:      nameRange.Start.Line,
+			character: nameRange.Start.Character,
+			length:    nameRange.End.Character - nameRange.Start.Character,
+			tokenType: tokenType,
+			modifiers: modifiers,
+		}
+		start := lsp.Position{Line: token.line, Character: token.character}
+		if seen[start] || (rng != nil && !tokenInRange(token, *rng)) {
+			continue
+		}
+		seen[start] = true
+		tokens = append(tokens, token)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].line != tokens[j].line {
+			return tokens[i].line < tokens[j].line
+		}
+		return tokens[i].character < tokens[j].character
+	})
+	return tokens
+}
+
+// classify returns the token type and modifiers of a name. It reports false
+// for names left to the grammar, such as self and undefined names.
+func (c *tokenClassifier) classify(ref *symbols.Reference) (int, int, bool) {
+	if ref.Name == "self" || ref.Name == "super" {
+		return 0, 0, false
+	}
+
+	modifiers := 0
+	if ref.IsDeclaration {
+		modifiers |= semanticModifier(lsp.SemanticTokenModifierDeclaration)
+	}
+	if ref.IsStatic {
+		modifiers |= semanticModifier(lsp.SemanticTokenModifierStatic)
+	}
+
+	symbol := c.analyzer.symbolTable.SymbolForReference(ref)
+	if symbol == nil {
+		switch {
+		case ref.IsMember:
+			// The receiver is unknown, so tell methods from fields by the call
+			rest := strings.TrimLeft(c.lines[ref.Line][ref.Column+len(ref.Name):], " \t")
+			if strings.HasPrefix(rest, "(") {
+				return semanticType(lsp.SemanticTokenMethod), modifiers, true
+			}
+			return semanticType(lsp.SemanticTokenProperty), modifiers, true
+		case c.builtinGrimoires[ref.Name]:
+			modifiers |= semanticModifier(lsp.SemanticTokenModifierDefaultLibrary)
+			return semanticType(lsp.SemanticTokenClass), modifiers, true
+		case c.builtinFunctions[ref.Name]:
+			modifiers |= semanticModifier(lsp.SemanticTokenModifierDefaultLibrary)
+			return semanticType(lsp.SemanticTokenFunction), modifiers, true
+		}
+		return 0, 0, false
+	}
+
+	var tokenType lsp.SemanticTokenTypes
+	switch symbol.Type {
+	case "Grimoire":
+		tokenType = lsp.SemanticTokenClass
+	case "spell":
+		tokenType = lsp.SemanticTokenFunction
+	case "method":
+		tokenType = lsp.SemanticTokenMethod
+	case "parameter":
+		tokenType = lsp.SemanticTokenParameter
+	case "field":
+		tokenType = lsp.SemanticTokenProperty
+	case "import":
+		tokenType = lsp.SemanticTokenNamespace
+	default:
+		tokenType = lsp.SemanticTokenVariable
+	}
+
+	if (symbol.Type == "variable" || symbol.Type == "field") && isConstantName(symbol.Name) {
+		modifiers |= semanticModifier(lsp.SemanticTokenModifierReadonly)
+	}
+	if symbol.Type == "Grimoire" || symbol.Type == "method" {
+		arcane, ok := c.arcane[symbol]
+		if !ok {
+			arcane = c.analyzer.isArcane(symbol)
+			c.arcane[symbol] = arcane
+		}
+		if arcane {
+			modifiers |= semanticModifier(lsp.SemanticTokenModifierAbstract)
+		}
+	}
+
+	return semanticType(tokenType), modifiers, true
+}
+
+// isArcane reports whether a Grimoire or method is declared abstract, with
+// "arcane grim" or an @arcanespell decorator. The parser does not keep these
+// markers, so they are read from the source of the declaration.
+func (a *CarrionAnalyzer) isArcane(symbol *symbols.Symbol) bool {
+	declaration := symbol.Declaration
+	if declaration == nil {
+		return false
+	}
+
+	text, ok := a.documentText(lsp.DocumentURI(declaration.URI))
+	if !ok {
+		return false
+	}
+	lines := strings.Split(text, "\n")
+	if declaration.Line >= len(lines) {
+		return false
+	}
+
+	header := strings.Fields(lines[declaration.Line])
+	if symbol.Type == "Grimoire" {
+		return len(header) > 0 && header[0] == "arcane"
+	}
+	if len(header) > 0 && header[0] == "arcanespell" {
+		return true
+	}
+	for line := declaration.Line - 1; line >= 0; line-- {
+		previous := strings.TrimSpace(lines[line])
+		if previous != "" {
+			return strings.HasPrefix(previous, "@arcanespell")
+		}
+	}
+	return false
+}
+
+// isConstantName reports whether a name follows the upper case naming
+// convention of constants
+func isConstantName(name string) bool {
+	hasLetter := false
+	for _, r := range name {
+		if unicode.IsLower(r) {
+			return false
+		}
+		hasLetter = hasLetter || unicode.IsUpper(r)
+	}
+	return hasLetter
+}
+
+// tokenInRange reports whether a token overlaps a range
+func tokenInRange(token semanticToken, rng lsp.Range) bool {
+	start := lsp.Position{Line: token.line, Character: token.character}
+	end := lsp.Position{Line: token.line, Character: token.character + token.length}
+	return positionLess(start, rng.End) && positionLess(rng.Start, end)
+}
+
+// encodeSemanticTokens encodes sorted tokens relative to one another as the
+// protocol requires
+func encodeSemanticTokens(tokens []semanticToken) []uint32 {
+	data := make([]uint32, 0, len(tokens)*5)
+	var line, character uint32
+	for _, token := range tokens {
+		deltaCharacter := token.character
+		if token.line == line {
+			deltaCharacter -= character
+		}
+		data = append(data,
+			token.line-line,
+			deltaCharacter,
+			token.length,
+			uint32(token.tokenType),
+			uint32(token.modifiers),
+		)
+		line, character = token.line, token.character
+	}
+	return data
+}
+
+// semanticTokensEdit returns the single edit replacing what differs between
+// two encoded token sets. It reports false when they are identical.
+func semanticTokensEdit(previous, current []uint32) (lsp.SemanticTokensEdit, bool) {
+	prefix := 0
+	for prefix < len(previous) && prefix < len(current) && previous[prefix] == current[prefix] {
+		prefix++
+	}
+	if prefix == len(previous) && prefix == len(current) {
+		return lsp.SemanticTokensEdit{}, false
+	}
+
+	suffix := 0
+	for suffix < len(previous)-prefix && suffix < len(current)-prefix &&
+		previous[len(previous)-1-suffix] == current[len(current)-1-suffix] {
+		suffix++
+	}
+
+	return lsp.SemanticTokensEdit{
+		Start:       uint32(prefix),
+		DeleteCount: uint32(len(previous) - prefix - suffix),
+		Data:        current[prefix : len(current)-suffix],
+	}, true
+}
+
+// semanticType returns the legend index of a token type
+func semanticType(tokenType lsp.SemanticTokenTypes) int {
+	for i, t := range semanticTokenTypes {
+		if t == tokenType {
+			return i
+		}
+	}
+	return 0
+}
+
+// semanticModifier returns the bit of a token modifier in the legend
+func semanticModifier(modifier lsp.SemanticTokenModifiers) int {
+	for i, m := range semanticTokenModifiers {
+		if m == modifier {
+			return 1 << i
+		}
+	}
+	return 0
+}
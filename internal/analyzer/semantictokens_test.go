@@ -0,0 +1,56 @@
+package analyzer
+
+import (
+	"sync"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestSemanticTokensDelta(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": "x = 1\nprint(x)\n"}, "test.crl")
+	uri := w.uri("test.crl")
+
+	full := w.GetSemanticTokens(uri)
+	w.change("test.crl", "x = 1\ny = 2\nprint(x, y)\n")
+
+	delta, ok := w.GetSemanticTokensDelta(uri, full.ResultID).(*lsp.SemanticTokensDelta)
+	if !ok {
+		t.Fatal("no delta against the last result")
+	}
+	if len(delta.Edits) != 1 || delta.ResultID == full.ResultID {
+		t.Errorf("delta = %+v, want one edit and a new result id", delta)
+	}
+
+	// The first result was replaced by the delta
+	if _, ok := w.GetSemanticTokensDelta(uri, full.ResultID).(*lsp.SemanticTokens); !ok {
+		t.Error("got a delta against a replaced result")
+	}
+}
+
+func TestConcurrentSemanticTokensDeltas(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": "x = 1\nprint(x)\n"}, "test.crl")
+	uri := w.uri("test.crl")
+	previous := w.GetSemanticTokens(uri).ResultID
+
+	var mu sync.Mutex
+	deltas := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := w.GetSemanticTokensDelta(uri, previous).(*lsp.SemanticTokensDelta); ok {
+				mu.Lock()
+				deltas++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each result replaces the previous one, so only one delta can be based on it
+	if deltas != 1 {
+		t.Errorf("%d requests got a delta against the same result, want 1", deltas)
+	}
+}
@@ -0,0 +1,88 @@
+package analyzer
+
+import (
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// Snapshot is the analysis of one version of an open document. A snapshot is
+// not modified once stored: analyzing a later version stores a new one.
+type Snapshot struct {
+	Document    *protocol.CarrionDocument
+	Program     *ast.Program
+	ParseErrors []string
+	Diagnostics []lsp.Diagnostic
+	// Symbols is the symbol table of the workspace as of this version
+	Symbols *symbols.SymbolTable
+}
+
+// Snapshot returns the latest snapshot of a document, nil when the document
+// has not been analyzed
+func (a *CarrionAnalyzer) Snapshot(uri lsp.DocumentURI) *Snapshot {
+	return a.snapshots[uri]
+}
+
+// DiscardSnapshot forgets the snapshot of a closed document
+func (a *CarrionAnalyzer) DiscardSnapshot(uri lsp.DocumentURI) {
+	if _, ok := a.snapshots[uri]; !ok {
+		return
+	}
+
+	snapshots := make(map[lsp.DocumentURI]*Snapshot, len(a.snapshots))
+	for u, snapshot := range a.snapshots {
+		if u != uri {
+			snapshots[u] = snapshot
+		}
+	}
+	a.snapshots = snapshots
+}
+
+// View returns an analyzer answering queries from the current snapshots and
+// symbol table. Later changes do not affect it, so it can be queried while
+// they are made. A view must not be changed itself.
+func (a *CarrionAnalyzer) View() *CarrionAnalyzer {
+	a.tableShared.Store(true)
+	return &CarrionAnalyzer{
+		logger:              a.logger,
+		documentStore:       a.documentStore,
+		symbolTable:         a.symbolTable,
+		snapshots:           a.snapshots,
+		workspaceFolders:    a.workspaceFolders,
+		resolveCodeActions:  a.resolveCodeActions,
+		semanticTokensCache: a.semanticTokensCache,
+		diagnosticsCache:    a.diagnosticsCache,
+		inlayHints:          a.inlayHints,
+	}
+}
+
+// storeSnapshot makes a snapshot the latest of its document
+func (a *CarrionAnalyzer) storeSnapshot(snapshot *Snapshot) {
+	snapshots := make(map[lsp.DocumentURI]*Snapshot, len(a.snapshots)+1)
+	for uri, s := range a.snapshots {
+		snapshots[uri] = s
+	}
+	snapshots[snapshot.Document.URI] = snapshot
+	a.snapshots = snapshots
+}
+
+// writableSymbols returns the symbol table for a change to modify, copying it
+// first when snapshots or views read it
+func (a *CarrionAnalyzer) writableSymbols() *symbols.SymbolTable {
+	if a.tableShared.Load() {
+		a.symbolTable = a.symbolTable.Clone()
+		a.tableShared.Store(false)
+	}
+	return a.symbolTable
+}
+
+// Document returns the version of an open document queries read: the one of
+// its latest snapshot, or the stored one when it has not been analyzed
+func (a *CarrionAnalyzer) Document(uri lsp.DocumentURI) *protocol.CarrionDocument {
+	if snapshot, ok := a.snapshots[uri]; ok {
+		return snapshot.Document
+	}
+	return a.documentStore.GetDocument(uri)
+}
@@ -0,0 +1,26 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+)
+
+func TestAnalyzeDocumentCancelled(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"cancelled.crl": "x = 1\nprint(x)\n"}, "cancelled.crl")
+	uri := w.uri("cancelled.crl")
+	before := w.Snapshot(uri)
+
+	if _, err := w.documentStore.UpdateDocument(uri, []protocol.TextDocumentContentChangeEvent{{Text: "y = 2\n"}}, 2); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.AnalyzeDocument(ctx, uri); err != context.Canceled {
+		t.Errorf("AnalyzeDocument error = %v, want %v", err, context.Canceled)
+	}
+	if w.Snapshot(uri) != before {
+		t.Error("a cancelled analysis replaced the snapshot")
+	}
+}
@@ -0,0 +1,102 @@
+package analyzer
+
+import (
+	"context"
+	"sort"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// PrepareTypeHierarchy returns the Grimoire at the given position as the root
+// of a type hierarchy
+func (a *CarrionAnalyzer) PrepareTypeHierarchy(uri lsp.DocumentURI, position lsp.Position) []protocol.TypeHierarchyItem {
+	if a.Document(uri) == nil {
+		a.logger.Warn("Cannot prepare type hierarchy for non-existent document: %s", uri)
+		return nil
+	}
+
+	symbol := a.symbolAtPosition(uri, position)
+	if symbol == nil || symbol.Type != "Grimoire" {
+		return nil
+	}
+	return []protocol.TypeHierarchyItem{a.typeHierarchyItem(symbol)}
+}
+
+// GetSupertypes returns the Grimoire the given one inherits from
+func (a *CarrionAnalyzer) GetSupertypes(item protocol.TypeHierarchyItem) []protocol.TypeHierarchyItem {
+	symbol := a.typeHierarchySymbol(item)
+	if symbol == nil {
+		return nil
+	}
+
+	parent := a.symbolTable.ParentGrimoire(symbol)
+	if parent == nil {
+		return []protocol.TypeHierarchyItem{}
+	}
+	return []protocol.TypeHierarchyItem{a.typeHierarchyItem(parent)}
+}
+
+// GetSubtypes returns the Grimoires of the workspace inheriting directly from
+// the given one. It returns nil once ctx is cancelled.
+func (a *CarrionAnalyzer) GetSubtypes(ctx context.Context, item protocol.TypeHierarchyItem) []protocol.TypeHierarchyItem {
+	symbol := a.typeHierarchySymbol(item)
+	if symbol == nil {
+		return nil
+	}
+
+	children := make([]*symbols.Symbol, 0)
+	for _, fileScope := range a.symbolTable.FileScopes {
+		if ctx.Err() != nil {
+			return nil
+		}
+		for _, candidate := range fileScope.Symbols {
+			if candidate.Type != "Grimoire" || candidate == symbol {
+				continue
+			}
+			if a.symbolTable.ParentGrimoire(candidate) == symbol {
+				children = append(children, candidate)
+			}
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].DefinitionURI != children[j].DefinitionURI {
+			return children[i].DefinitionURI < children[j].DefinitionURI
+		}
+		return children[i].DefinitionLine < children[j].DefinitionLine
+	})
+
+	items := make([]protocol.TypeHierarchyItem, 0, len(children))
+	for _, child := range children {
+		items = append(items, a.typeHierarchyItem(child))
+	}
+	return items
+}
+
+// typeHierarchySymbol finds the Grimoire a type hierarchy item was made for
+// from the position of its name
+func (a *CarrionAnalyzer) typeHierarchySymbol(item protocol.TypeHierarchyItem) *symbols.Symbol {
+	symbol := a.symbolAtPosition(item.URI, item.SelectionRange.Start)
+	if symbol == nil || symbol.Type != "Grimoire" {
+		return nil
+	}
+	return symbol
+}
+
+// typeHierarchyItem describes a Grimoire in a type hierarchy, detailing
+// arcane ones, which are only meant to be inherited from
+func (a *CarrionAnalyzer) typeHierarchyItem(symbol *symbols.Symbol) protocol.TypeHierarchyItem {
+	item := protocol.TypeHierarchyItem{
+		Name:           symbol.Name,
+		Kind:           lsp.SymbolKindClass,
+		URI:            lsp.DocumentURI(symbol.DefinitionURI),
+		Range:          a.definitionRange(symbol),
+		SelectionRange: a.symbolNameRange(symbol),
+	}
+	if a.isArcane(symbol) {
+		item.Detail = "arcane"
+	}
+	return item
+}
@@ -0,0 +1,104 @@
+package analyzer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+)
+
+// typeHierarchyFiles derive Grimoires from an arcane one of another file
+var typeHierarchyFiles = map[string]string{
+	"base.crl": "" +
+		"arcane grim Shape:\n" +
+		"    @arcanespell\n" +
+		"    spell area():\n",
+	"shapes.crl": "" +
+		"import \"base\"\n" +
+		"grim Circle(Shape):\n" +
+		"    spell area():\n" +
+		"        return 3\n" +
+		"grim Square(Shape):\n" +
+		"    spell area():\n" +
+		"        return 4\n" +
+		"grim Unit(Square):\n" +
+		"    spell side():\n" +
+		"        return 1\n",
+}
+
+// typeNames returns the names and details of type hierarchy items
+func typeNames(items []protocol.TypeHierarchyItem) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		name := item.Name
+		if item.Detail != "" {
+			name += " (" + item.Detail + ")"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestTypeHierarchy(t *testing.T) {
+	w := newTestWorkspace(t, typeHierarchyFiles, "base.crl", "shapes.crl")
+
+	tests := []struct {
+		name       string
+		file       string
+		line       uint32
+		character  uint32
+		supertypes []string
+		subtypes   []string
+	}{
+		{"arcane base", "base.crl", 0, 13, []string{}, []string{"Circle", "Square"}},
+		{"child of another file", "shapes.crl", 1, 6, []string{"Shape (arcane)"}, []string{}},
+		{"child with children", "shapes.crl", 4, 6, []string{"Shape (arcane)"}, []string{"Unit"}},
+		{"grandchild", "shapes.crl", 7, 6, []string{"Square"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := w.PrepareTypeHierarchy(w.uri(tt.file), lsp.Position{Line: tt.line, Character: tt.character})
+			if len(items) != 1 {
+				t.Fatalf("PrepareTypeHierarchy = %v, want one item", items)
+			}
+			if got := typeNames(w.GetSupertypes(items[0])); !reflect.DeepEqual(got, tt.supertypes) {
+				t.Errorf("GetSupertypes = %v, want %v", got, tt.supertypes)
+			}
+			if got := typeNames(w.GetSubtypes(context.Background(), items[0])); !reflect.DeepEqual(got, tt.subtypes) {
+				t.Errorf("GetSubtypes = %v, want %v", got, tt.subtypes)
+			}
+		})
+	}
+}
+
+func TestTypeHierarchyItemRanges(t *testing.T) {
+	w := newTestWorkspace(t, typeHierarchyFiles, "base.crl", "shapes.crl")
+
+	items := w.PrepareTypeHierarchy(w.uri("shapes.crl"), lsp.Position{Line: 7, Character: 6})
+	if len(items) != 1 {
+		t.Fatalf("PrepareTypeHierarchy = %v, want one item", items)
+	}
+	parents := w.GetSupertypes(items[0])
+	if len(parents) != 1 {
+		t.Fatalf("GetSupertypes = %v, want one parent", parents)
+	}
+	parents = w.GetSupertypes(parents[0])
+	if len(parents) != 1 {
+		t.Fatalf("GetSupertypes of the parent = %v, want one parent", parents)
+	}
+
+	shape := parents[0]
+	if shape.Name != "Shape" || shape.URI != w.uri("base.crl") {
+		t.Errorf("root = %s in %s, want Shape in base.crl", shape.Name, shape.URI)
+	}
+	name := lsp.Range{Start: lsp.Position{Line: 0, Character: 12}, End: lsp.Position{Line: 0, Character: 17}}
+	if shape.SelectionRange != name {
+		t.Errorf("selection range = %v, want %v", shape.SelectionRange, name)
+	}
+	if shape.Range.Start.Line != 0 || shape.Range.End.Line != 2 {
+		t.Errorf("range = %v, want lines 0 to 2", shape.Range)
+	}
+}
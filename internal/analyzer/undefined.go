@@ -0,0 +1,153 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// checkUndefinedNames reports names that no definition visible from their use
+// provides, and variables read before any assignment in the same scope
+func (a *CarrionAnalyzer) checkUndefinedNames(doc *protocol.CarrionDocument, program *ast.Program) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	uri := doc.URI
+
+	// The names an unresolved import provides are unknown
+	for _, imp := range a.symbolTable.Imports[string(uri)] {
+		if imp.BoundName() != "" {
+			continue
+		}
+		if _, indexed := a.symbolTable.FileScopes[imp.URI]; !indexed {
+			return diagnostics
+		}
+	}
+
+	builtins := a.builtinNames()
+	loops := loopLines(program)
+	lines := strings.Split(doc.Text, "\n")
+	for _, ref := range a.symbolTable.References[string(uri)] {
+		if ref.IsDeclaration || ref.IsMember {
+			continue
+		}
+
+		var message, code string
+		switch {
+		case ref.Symbol == nil:
+			if a.isDefinedOutsideFile(ref.Name, string(uri), builtins) {
+				continue
+			}
+			message = fmt.Sprintf("undefined: %s", ref.Name)
+			code = "undefined-name"
+		case usedBeforeAssignment(ref, loops):
+			message = fmt.Sprintf("%s is used before it is assigned", ref.Name)
+			code = "used-before-assignment"
+		default:
+			continue
+		}
+
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    spanRange(referenceSpan(ref), lines),
+			Severity: protocol.DiagnosticSeverity["warning"],
+			Code:     code,
+			Source:   "carrion-lsp",
+			Message:  message,
+		})
+	}
+
+	return diagnostics
+}
+
+// isDefinedOutsideFile reports whether a name is provided by the language or
+// by the imports of a file
+func (a *CarrionAnalyzer) isDefinedOutsideFile(name string, uri string, builtins map[string]bool) bool {
+	switch {
+	case name == "self", name == "super", builtins[name], isCarrionKeyword(name):
+		return true
+	case a.symbolTable.Global.Symbols[name] != nil:
+		return true
+	}
+	return a.symbolTable.ImportedSymbol(name, uri) != nil
+}
+
+// lineRange is a range of 0-based lines, both ends included
+type lineRange struct {
+	start, end int
+}
+
+// contains reports whether a line falls within the range
+func (r lineRange) contains(line int) bool {
+	return line >= r.start && line <= r.end
+}
+
+// loopLines returns the lines spanned by each loop of a program
+func loopLines(program *ast.Program) []lineRange {
+	loops := make([]lineRange, 0)
+	var walk func(node ast.Node)
+	walk = func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.ForStatement:
+			loops = append(loops, lineRange{n.Token.Line - 1, symbols.LastLine(n)})
+		case *ast.WhileStatement:
+			loops = append(loops, lineRange{n.Token.Line - 1, symbols.LastLine(n)})
+		}
+		for _, child := range symbols.Children(node) {
+			walk(child)
+		}
+	}
+	if program != nil {
+		walk(program)
+	}
+	return loops
+}
+
+// usedBeforeAssignment reports whether a reference reads a variable that no
+// assignment in the same scope can have given a value yet. Branches are not
+// followed, so an assignment on an earlier line counts whichever branch holds
+// it, and so does any assignment in a loop around the reference, which runs
+// before the reference on the next iteration.
+func usedBeforeAssignment(ref *symbols.Reference, loops []lineRange) bool {
+	symbol := ref.Symbol
+	if symbol.Type != "variable" && symbol.Type != "instance" {
+		return false
+	}
+
+	declaration := symbol.Declaration
+	if declaration == nil || declaration.Scope != ref.Scope || ref.IsWrite {
+		return false
+	}
+
+	writes := []*symbols.Reference{declaration}
+	for _, other := range symbol.References {
+		if other.IsWrite {
+			writes = append(writes, other)
+		}
+	}
+	for _, write := range writes {
+		if write.Line <= ref.Line {
+			return false
+		}
+		for _, loop := range loops {
+			if loop.contains(ref.Line) && loop.contains(write.Line) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// builtinNames returns the names of the built-in functions and Grimoires
+func (a *CarrionAnalyzer) builtinNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, item := range a.getBuiltinCompletions() {
+		names[item.Label] = true
+	}
+	for _, item := range a.getBuiltinGrimoireNames() {
+		names[item.Label] = true
+	}
+	return names
+}
@@ -0,0 +1,80 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestUndefinedNames(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "plain parameter",
+			text: "spell f(x): return x\n",
+		},
+		{
+			name: "plain method parameters",
+			text: "grim Counter:\n" +
+				"    spell add(a, b):\n" +
+				"        return a + b\n",
+		},
+		{
+			name: "undefined name",
+			text: "spell f(x):\n" +
+				"    return x + y\n",
+			want: []string{"undefined: y"},
+		},
+		{
+			name: "assigned later in the loop",
+			text: "spell run(items):\n" +
+				"    for item in items:\n" +
+				"        if item > 0:\n" +
+				"            print(prev)\n" +
+				"        prev = item\n",
+		},
+		{
+			name: "assigned in a branch",
+			text: "flag = 1\n" +
+				"if flag:\n" +
+				"    total = 1\n" +
+				"    print(total)\n" +
+				"total = 5\n" +
+				"print(total)\n",
+		},
+		{
+			name: "used before assignment",
+			text: "print(late)\n" +
+				"late = 1\n" +
+				"print(late)\n",
+			want: []string{"late is used before it is assigned"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := analyzeText(t, tt.text)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("diagnostics = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUndefinedNameRange(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": "s = \"é\" + y\n"}, "test.crl")
+
+	diagnostics := w.Snapshot(w.uri("test.crl")).Diagnostics
+	if len(diagnostics) != 1 {
+		t.Fatalf("diagnostics = %v, want one about y", diagnostics)
+	}
+	// é is one UTF-16 code unit but two bytes
+	want := lsp.Range{Start: lsp.Position{Line: 0, Character: 10}, End: lsp.Position{Line: 0, Character: 11}}
+	if diagnostics[0].Range != want {
+		t.Errorf("range = %v, want %v", diagnostics[0].Range, want)
+	}
+}
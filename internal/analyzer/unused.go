@@ -0,0 +1,351 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// diagnosticFix is carried in the data of a diagnostic that an edit can fix
+type diagnosticFix struct {
+	Title string         `json:"title"`
+	Edits []lsp.TextEdit `json:"edits"`
+}
+
+// checkUnused reports spell locals that are assigned but never read, spell
+// parameters that are never referenced and imports that are never used
+func (a *CarrionAnalyzer) checkUnused(doc *protocol.CarrionDocument) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+
+	fileScope, ok := a.symbolTable.FileScopes[string(doc.URI)]
+	if !ok {
+		return diagnostics
+	}
+	lines := strings.Split(doc.Text, "\n")
+
+	// Scopes holding at least one use of a name; spells without any, such as
+	// arcane spells, are not expected to use their parameters
+	usedScopes := make(map[*symbols.Scope]bool)
+	for _, ref := range a.symbolTable.References[string(doc.URI)] {
+		if !ref.IsDeclaration {
+			usedScopes[ref.Scope] = true
+		}
+	}
+
+	// Spells holding code whose names are not recorded may read any of their
+	// locals unseen, so none of them is reported, let alone removed. The
+	// Grimoire of a method is nil for spells.
+	checkSpell := func(spell, grimoire *symbols.Symbol) {
+		if spell.Scope == nil || spell.Scope.UnknownReads {
+			return
+		}
+		for _, local := range spell.Scope.Symbols {
+			if isExemptFromUnused(local.Name) || local.Declaration == nil || isRead(local) {
+				continue
+			}
+
+			switch {
+			case local.Type == "parameter" && usedScopes[spell.Scope]:
+				// Removing a parameter that calls pass would break them
+				var fix *lsp.TextEdit
+				if !a.hasCallers(spell, grimoire) {
+					fix = parameterRemoval(local, lines)
+				}
+				diagnostics = append(diagnostics, unusedDiagnostic(
+					local, "unused-parameter",
+					fmt.Sprintf("parameter %s is never used", local.Name),
+					fix, lines,
+				))
+			case (local.Type == "variable" || local.Type == "instance") && local.Binding != nil:
+				diagnostics = append(diagnostics, unusedDiagnostic(
+					local, "unused-variable",
+					fmt.Sprintf("%s is assigned but never used", local.Name),
+					bindingRemoval(local, lines), lines,
+				))
+			}
+		}
+	}
+
+	for _, symbol := range fileScope.Symbols {
+		switch symbol.Type {
+		case "spell":
+			checkSpell(symbol, nil)
+		case "Grimoire":
+			if symbol.Scope != nil && symbol.Scope.Grimoire != nil {
+				for _, method := range symbol.Scope.Grimoire.Methods {
+					checkSpell(method, symbol)
+				}
+			}
+		}
+	}
+
+	diagnostics = append(diagnostics, a.checkUnusedImports(doc.URI, lines)...)
+
+	sort.Slice(diagnostics, func(i, j int) bool {
+		return positionLess(diagnostics[i].Range.Start, diagnostics[j].Range.Start)
+	})
+	return diagnostics
+}
+
+// checkUnusedImports reports imports none of whose names are used in the file
+func (a *CarrionAnalyzer) checkUnusedImports(uri lsp.DocumentURI, lines []string) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+
+	usedNames := make(map[string]bool)
+	for _, ref := range a.symbolTable.References[string(uri)] {
+		if !ref.IsDeclaration && !ref.IsMember {
+			usedNames[ref.Name] = true
+		}
+	}
+
+	for _, imp := range a.symbolTable.Imports[string(uri)] {
+		if name := imp.BoundName(); name != "" {
+			if usedNames[name] {
+				continue
+			}
+		} else {
+			// Without knowing what the imported file defines, any of it may be used
+			if _, indexed := a.symbolTable.FileScopes[imp.URI]; !indexed {
+				continue
+			}
+			used := false
+			for _, symbol := range a.symbolTable.ModuleSymbols(imp) {
+				if symbol.Type == "Grimoire" && usedNames[symbol.Name] {
+					used = true
+					break
+				}
+			}
+			if used {
+				continue
+			}
+		}
+
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    importRange(imp, lines),
+			Severity: protocol.DiagnosticSeverity["warning"],
+			Code:     "unused-import",
+			Source:   "carrion-lsp",
+			Message:  fmt.Sprintf("import %q is never used", imp.Path),
+			Tags:     []lsp.DiagnosticTag{lsp.DiagnosticTagUnnecessary},
+			Data: diagnosticFix{
+				Title: "Remove unused import",
+				Edits: []lsp.TextEdit{{Range: lineRemovalRange(lines, imp.Line, imp.Line)}},
+			},
+		})
+	}
+
+	return diagnostics
+}
+
+// hasCallers reports whether a spell, or a method of the given Grimoire, is
+// used anywhere in the workspace. Constructing a Grimoire calls its init
+// method.
+func (a *CarrionAnalyzer) hasCallers(spell, grimoire *symbols.Symbol) bool {
+	if len(a.symbolTable.FindReferences(spell, false)) > 0 {
+		return true
+	}
+	return grimoire != nil && spell.Name == "init" && len(a.symbolTable.FindReferences(grimoire, false)) > 0
+}
+
+// unusedDiagnostic builds the warning for an unused binding of the file with
+// the given lines, with a quick fix removing it
+func unusedDiagnostic(symbol *symbols.Symbol, code, message string, fix *lsp.TextEdit, lines []string) lsp.Diagnostic {
+	diagnostic := lsp.Diagnostic{
+		Range:    spanRange(referenceSpan(symbol.Declaration), lines),
+		Severity: protocol.DiagnosticSeverity["warning"],
+		Code:     code,
+		Source:   "carrion-lsp",
+		Message:  message,
+		Tags:     []lsp.DiagnosticTag{lsp.DiagnosticTagUnnecessary},
+	}
+
+	if fix != nil {
+		title := "Remove unused variable " + symbol.Name
+		if symbol.Type == "parameter" {
+			title = "Remove unused parameter " + symbol.Name
+		}
+		diagnostic.Data = diagnosticFix{Title: title, Edits: []lsp.TextEdit{*fix}}
+	}
+	return diagnostic
+}
+
+// isExemptFromUnused reports whether a name is deliberately left unused
+func isExemptFromUnused(name string) bool {
+	return name == "self" || strings.HasPrefix(name, "_")
+}
+
+// isRead reports whether a symbol is read anywhere
+func isRead(symbol *symbols.Symbol) bool {
+	for _, ref := range symbol.References {
+		if !ref.IsWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// bindingRemoval returns the edit removing the assignment of an unused
+// variable. Assignments whose value may have side effects keep the value.
+func bindingRemoval(symbol *symbols.Symbol, lines []string) *lsp.TextEdit {
+	assign, ok := symbol.Binding.(*ast.AssignStatement)
+	if !ok {
+		return nil
+	}
+
+	declaration := symbol.Declaration
+	if !containsCall(assign.Value) {
+		endLine := symbols.LastLine(assign)
+		if endLine < declaration.Line {
+			endLine = declaration.Line
+		}
+		return &lsp.TextEdit{Range: lineRemovalRange(lines, declaration.Line, endLine)}
+	}
+
+	// Drop "name = " and keep the call
+	if declaration.Line >= len(lines) {
+		return nil
+	}
+	line := lines[declaration.Line]
+	for i := declaration.Column + len(symbol.Name); i < len(line); i++ {
+		if line[i] != '=' || (i+1 < len(line) && line[i+1] == '=') {
+			continue
+		}
+		end := i + 1
+		for end < len(line) && (line[end] == ' ' || line[end] == '\t') {
+			end++
+		}
+		return &lsp.TextEdit{Range: spanRange(symbols.Span{
+			StartLine:   declaration.Line,
+			StartColumn: declaration.Column,
+			EndLine:     declaration.Line,
+			EndColumn:   end,
+		}, lines)}
+	}
+	return nil
+}
+
+// parameterRemoval returns the edit removing an unused parameter, along with
+// its type hint, default value and separating comma
+func parameterRemoval(symbol *symbols.Symbol, lines []string) *lsp.TextEdit {
+	declaration := symbol.Declaration
+	if declaration.Line >= len(lines) {
+		return nil
+	}
+	line := lines[declaration.Line]
+
+	// Find where the parameter ends, skipping nested brackets and strings
+	end := declaration.Column
+	depth := 0
+	var quote byte
+scan:
+	for ; end < len(line); end++ {
+		c := line[end]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			if depth == 0 {
+				break scan
+			}
+			depth--
+		case c == ',' && depth == 0:
+			break scan
+		}
+	}
+	if end >= len(line) {
+		return nil
+	}
+
+	start := declaration.Column
+	if line[end] == ',' {
+		// Remove the comma after the parameter and the space before the next one
+		end++
+		for end < len(line) && line[end] == ' ' {
+			end++
+		}
+	} else {
+		// Last parameter: remove the comma before it instead
+		prev := start
+		for prev > 0 && line[prev-1] == ' ' {
+			prev--
+		}
+		if prev > 0 && line[prev-1] == ',' {
+			start = prev - 1
+		}
+	}
+
+	return &lsp.TextEdit{Range: spanRange(symbols.Span{
+		StartLine:   declaration.Line,
+		StartColumn: start,
+		EndLine:     declaration.Line,
+		EndColumn:   end,
+	}, lines)}
+}
+
+// lineRemovalRange returns the range covering whole lines, including the
+// line break that ends them
+func lineRemovalRange(lines []string, startLine, endLine int) lsp.Range {
+	if endLine+1 < len(lines) {
+		return lsp.Range{
+			Start: lsp.Position{Line: uint32(startLine)},
+			End:   lsp.Position{Line: uint32(endLine + 1)},
+		}
+	}
+
+	// The last line has no line break of its own, so take the previous one
+	span := symbols.Span{StartLine: startLine, EndLine: endLine}
+	if startLine > 0 && startLine-1 < len(lines) {
+		span.StartLine, span.StartColumn = startLine-1, len(lines[startLine-1])
+	}
+	if endLine < len(lines) {
+		span.EndColumn = len(lines[endLine])
+	}
+	return spanRange(span, lines)
+}
+
+// containsCall reports whether evaluating an expression calls a spell
+func containsCall(expr ast.Expression) bool {
+	switch node := expr.(type) {
+	case *ast.CallExpression:
+		return true
+	case *ast.PrefixExpression:
+		return containsCall(node.Right)
+	case *ast.InfixExpression:
+		return containsCall(node.Left) || containsCall(node.Right)
+	case *ast.DotExpression:
+		return containsCall(node.Left)
+	case *ast.IndexExpression:
+		return containsCall(node.Left) || containsCall(node.Index)
+	case *ast.ArrayLiteral:
+		for _, elem := range node.Elements {
+			if containsCall(elem) {
+				return true
+			}
+		}
+	case *ast.TupleLiteral:
+		for _, elem := range node.Elements {
+			if containsCall(elem) {
+				return true
+			}
+		}
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			if containsCall(key) || containsCall(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
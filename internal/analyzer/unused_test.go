@@ -0,0 +1,164 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestUnusedBindings(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "incremented",
+			text: "spell f():\n" +
+				"    count = 0\n" +
+				"    count++\n" +
+				"    return 1\n",
+		},
+		{
+			name: "compound assignment",
+			text: "spell f():\n" +
+				"    total = 0\n" +
+				"    total += 1\n" +
+				"    return 1\n",
+		},
+		{
+			name: "read in an f-string",
+			text: "spell f():\n" +
+				"    name = \"raven\"\n" +
+				"    return f\"hello {name}\"\n",
+		},
+		{
+			name: "read in a check",
+			text: "spell f(x):\n" +
+				"    limit = 3\n" +
+				"    check(x < limit, f\"{x} is too large\")\n" +
+				"    return x\n",
+		},
+		{
+			name: "read by a nested spell",
+			text: "spell outer():\n" +
+				"    seen = 0\n" +
+				"    spell inner():\n" +
+				"        return seen\n" +
+				"    return inner\n",
+		},
+		{
+			name: "read by a nested Grimoire",
+			text: "spell outer():\n" +
+				"    seen = 0\n" +
+				"    grim Inner:\n" +
+				"        spell get():\n" +
+				"            return seen\n" +
+				"    return Inner\n",
+		},
+		{
+			name: "named in a dict literal key",
+			text: "spell f():\n" +
+				"    key = 1\n" +
+				"    d = {\"key\": 2}\n" +
+				"    return d\n",
+			want: []string{"key is assigned but never used"},
+		},
+		{
+			name: "plain parameter",
+			text: "spell f(a, b):\n" +
+				"    return a\n",
+			want: []string{"parameter b is never used"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := analyzeText(t, tt.text)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("diagnostics = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnusedParameterFix(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		removes bool
+	}{
+		{
+			name: "no callers",
+			text: "spell f(a, b):\n" +
+				"    return a\n",
+			removes: true,
+		},
+		{
+			name: "called",
+			text: "spell f(a, b):\n" +
+				"    return a\n" +
+				"f(1, 2)\n",
+		},
+		{
+			name: "method called on an unknown object",
+			text: "grim Shape:\n" +
+				"    spell scale(a, b):\n" +
+				"        return a\n" +
+				"spell grow(shape):\n" +
+				"    return shape.scale(1, 2)\n",
+		},
+		{
+			name: "init of a constructed Grimoire",
+			text: "grim Shape:\n" +
+				"    spell init(a, b):\n" +
+				"        self.a = a\n" +
+				"s = Shape(1, 2)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorkspace(t, map[string]string{"test.crl": tt.text}, "test.crl")
+			var unused *lsp.Diagnostic
+			for _, diagnostic := range w.Snapshot(w.uri("test.crl")).Diagnostics {
+				if diagnostic.Code == "unused-parameter" {
+					unused = &diagnostic
+				}
+			}
+			if unused == nil {
+				t.Fatal("b is not reported")
+			}
+			if removes := unused.Data != nil; removes != tt.removes {
+				t.Errorf("offers removal = %v, want %v", removes, tt.removes)
+			}
+		})
+	}
+}
+
+func TestUnusedParameterRanges(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{"test.crl": "" +
+		"spell f(a = \"é\", b = 1):\n" +
+		"    return a\n",
+	}, "test.crl")
+
+	diagnostics := w.Snapshot(w.uri("test.crl")).Diagnostics
+	if len(diagnostics) != 1 {
+		t.Fatalf("diagnostics = %v, want one about b", diagnostics)
+	}
+
+	// é is one UTF-16 code unit but two bytes
+	want := lsp.Range{Start: lsp.Position{Character: 17}, End: lsp.Position{Character: 18}}
+	if diagnostics[0].Range != want {
+		t.Errorf("range = %v, want %v", diagnostics[0].Range, want)
+	}
+	fix, ok := diagnostics[0].Data.(diagnosticFix)
+	if !ok || len(fix.Edits) != 1 {
+		t.Fatalf("fix = %v, want one edit", diagnostics[0].Data)
+	}
+	want = lsp.Range{Start: lsp.Position{Character: 15}, End: lsp.Position{Character: 22}}
+	if fix.Edits[0].Range != want {
+		t.Errorf("removed range = %v, want %v", fix.Edits[0].Range, want)
+	}
+}
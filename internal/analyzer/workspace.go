@@ -0,0 +1,178 @@
+package analyzer
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	"github.com/javanhut/TheCarrionLanguage/src/lexer"
+	"github.com/javanhut/TheCarrionLanguage/src/parser"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+// SetWorkspaceFolders sets the root folders searched for Carrion files that
+// are not open in the editor
+func (a *CarrionAnalyzer) SetWorkspaceFolders(folders []lsp.DocumentURI) {
+	a.workspaceFolders = nil
+	for _, folder := range folders {
+		if path, ok := uriToPath(folder); ok {
+			a.workspaceFolders = append(a.workspaceFolders, path)
+		}
+	}
+}
+
+// ParseFile reads and parses a Carrion file from disk, returning its program
+// and content. The program is nil when the file cannot be read or has parse
+// errors. It does not touch the symbol table, so several files may be parsed
+// concurrently.
+func (a *CarrionAnalyzer) ParseFile(path string) (*ast.Program, string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		a.logger.Warn("Cannot read %s: %v", path, err)
+		return nil, ""
+	}
+	return a.parseWorkspaceText(uri.File(path), string(content)), string(content)
+}
+
+// IndexProgram adds the symbols of a parsed workspace file to the symbol table.
+// Files open in the editor are skipped, as their buffer is authoritative.
+func (a *CarrionAnalyzer) IndexProgram(uri lsp.DocumentURI, program *ast.Program, text string) {
+	if a.documentStore.GetDocument(uri) != nil {
+		return
+	}
+	a.writableSymbols().BuildFromAST(program, string(uri), text)
+	a.resolveImports(uri)
+}
+
+// ReindexFile refreshes the symbols of a file that is not open in the editor
+// from its content on disk. When the file or folder no longer exists, the
+// symbols of every file under it are dropped.
+func (a *CarrionAnalyzer) ReindexFile(u lsp.DocumentURI) {
+	if a.documentStore.GetDocument(u) != nil {
+		return
+	}
+
+	path, ok := uriToPath(u)
+	if !ok {
+		a.writableSymbols().RemoveFile(string(u))
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		a.logger.Debug("Dropping symbols of removed path %s", path)
+		st := a.writableSymbols()
+		for fileURI := range st.FileScopes {
+			if fileURI == string(u) || strings.HasPrefix(fileURI, string(u)+"/") {
+				st.RemoveFile(fileURI)
+			}
+		}
+		return
+	}
+
+	if info.IsDir() || filepath.Ext(path) != ".crl" {
+		return
+	}
+	if program, text := a.ParseFile(path); program != nil {
+		a.IndexProgram(u, program, text)
+	}
+}
+
+// parseWorkspaceText parses the content of a workspace file
+func (a *CarrionAnalyzer) parseWorkspaceText(uri lsp.DocumentURI, text string) *ast.Program {
+	l := lexer.New(text)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 || program == nil {
+		a.logger.Debug("Skipping index of %s: %d parse errors", uri, len(p.Errors()))
+		return nil
+	}
+	return program
+}
+
+// parseDocument parses the content of an open document. Unlike
+// parseWorkspaceText it keeps what the parser recovered from a document with
+// errors, as the document is usually being edited.
+func (a *CarrionAnalyzer) parseDocument(text string) *ast.Program {
+	l := lexer.New(text)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// indexUnopenedFiles adds every Carrion file in the workspace that the symbol
+// table does not know about yet, stopping with the error of ctx once ctx is
+// cancelled
+func (a *CarrionAnalyzer) indexUnopenedFiles(ctx context.Context) error {
+	for _, path := range a.WorkspaceFiles() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fileURI := uri.File(path)
+		if _, ok := a.symbolTable.FileScopes[string(fileURI)]; ok {
+			continue
+		}
+
+		if program, text := a.ParseFile(path); program != nil {
+			a.IndexProgram(fileURI, program, text)
+		}
+	}
+	return nil
+}
+
+// WorkspaceFiles returns the paths of all Carrion files in the workspace folders
+func (a *CarrionAnalyzer) WorkspaceFiles() []string {
+	files := make([]string, 0)
+	for _, root := range a.workspaceFolders {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(path) == ".crl" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			a.logger.Warn("Cannot walk workspace folder %s: %v", root, err)
+		}
+	}
+	return files
+}
+
+// documentText returns the content of a file, from the editor buffer when
+// the file is open and from disk otherwise
+func (a *CarrionAnalyzer) documentText(u lsp.DocumentURI) (string, bool) {
+	if doc := a.Document(u); doc != nil {
+		return doc.Text, true
+	}
+
+	path, ok := uriToPath(u)
+	if !ok {
+		return "", false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return string(content), true
+}
+
+// uriToPath converts a file URI into a file system path
+func uriToPath(u lsp.DocumentURI) (string, bool) {
+	if !strings.HasPrefix(string(u), uri.FileScheme+"://") {
+		return "", false
+	}
+	return u.Filename(), true
+}
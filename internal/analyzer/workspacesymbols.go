@@ -0,0 +1,145 @@
+package analyzer
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/symbols"
+)
+
+// maxWorkspaceSymbols caps the number of results of a workspace symbol search
+const maxWorkspaceSymbols = 100
+
+// Match tiers of a workspace symbol search, best first
+const (
+	matchNone = iota
+	matchFuzzy
+	matchPrefix
+	matchExact
+)
+
+// workspaceSymbolMatch is a candidate result of a workspace symbol search
+type workspaceSymbolMatch struct {
+	info    lsp.SymbolInformation
+	symbol  *symbols.Symbol
+	tier    int
+	penalty int
+}
+
+// GetWorkspaceSymbols returns the Grimoires, spells and methods of the whole
+// workspace whose names match query, best matches first. It returns nil once
+// ctx is cancelled.
+func (a *CarrionAnalyzer) GetWorkspaceSymbols(ctx context.Context, query string) []lsp.SymbolInformation {
+	matches := make([]workspaceSymbolMatch, 0)
+	addMatch := func(symbol *symbols.Symbol, kind lsp.SymbolKind, container string) {
+		tier, penalty := matchSymbolName(symbol.Name, query)
+		if tier == matchNone {
+			return
+		}
+		matches = append(matches, workspaceSymbolMatch{
+			info: lsp.SymbolInformation{
+				Name: symbol.Name,
+				Kind: kind,
+				Location: lsp.Location{
+					URI: lsp.DocumentURI(symbol.DefinitionURI),
+				},
+				ContainerName: container,
+			},
+			symbol:  symbol,
+			tier:    tier,
+			penalty: penalty,
+		})
+	}
+
+	for _, fileScope := range a.symbolTable.FileScopes {
+		if ctx.Err() != nil {
+			return nil
+		}
+		for _, symbol := range fileScope.Symbols {
+			switch symbol.Type {
+			case "spell":
+				addMatch(symbol, lsp.SymbolKindFunction, "")
+			case "Grimoire":
+				addMatch(symbol, lsp.SymbolKindClass, "")
+				if symbol.Scope == nil || symbol.Scope.Grimoire == nil {
+					continue
+				}
+				for _, method := range symbol.Scope.Grimoire.Methods {
+					kind := lsp.SymbolKindMethod
+					if method.Name == "init" {
+						kind = lsp.SymbolKindConstructor
+					}
+					addMatch(method, kind, symbol.Name)
+				}
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].tier != matches[j].tier {
+			return matches[i].tier > matches[j].tier
+		}
+		if matches[i].penalty != matches[j].penalty {
+			return matches[i].penalty < matches[j].penalty
+		}
+		if matches[i].info.Name != matches[j].info.Name {
+			return matches[i].info.Name < matches[j].info.Name
+		}
+		return matches[i].info.Location.URI < matches[j].info.Location.URI
+	})
+
+	if len(matches) > maxWorkspaceSymbols {
+		matches = matches[:maxWorkspaceSymbols]
+	}
+
+	// Only the files of the returned symbols are read to locate them
+	lines := a.newFileLines()
+	results := make([]lsp.SymbolInformation, 0, len(matches))
+	for _, match := range matches {
+		match.info.Location.Range = lines.symbolNameRange(match.symbol)
+		results = append(results, match.info)
+	}
+	return results
+}
+
+// matchSymbolName ranks how well a symbol name matches a search query.
+//
+// Exact matches rank above prefix matches, which rank above fuzzy matches
+// where the query characters appear in order anywhere in the name. Within a
+// tier a lower penalty is better. Matching ignores case, but a case-sensitive
+// hit is preferred.
+func matchSymbolName(name, query string) (int, int) {
+	if query == "" {
+		return matchFuzzy, len(name)
+	}
+
+	lowerName := strings.ToLower(name)
+	lowerQuery := strings.ToLower(query)
+
+	switch {
+	case name == query:
+		return matchExact, 0
+	case lowerName == lowerQuery:
+		return matchExact, 1
+	case strings.HasPrefix(name, query):
+		return matchPrefix, len(name) - len(query)
+	case strings.HasPrefix(lowerName, lowerQuery):
+		return matchPrefix, len(name) - len(query) + 1
+	}
+
+	// Fuzzy match: penalize characters skipped before and between matches
+	penalty := 0
+	next := 0
+	for i := 0; i < len(lowerQuery); i++ {
+		idx := strings.IndexByte(lowerName[next:], lowerQuery[i])
+		if idx < 0 {
+			return matchNone, 0
+		}
+		penalty += idx
+		next += idx + 1
+	}
+	return matchFuzzy, penalty
+}
@@ -0,0 +1,38 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestWorkspaceSymbols(t *testing.T) {
+	w := newTestWorkspace(t, map[string]string{
+		"shapes.crl": "" +
+			"grim Shape:\n" +
+			"    spell area():\n" +
+			"        return 0\n",
+		"sizes.crl": "" +
+			"spell µarea(): return 1\n",
+	}, "shapes.crl", "sizes.crl")
+
+	got := w.GetWorkspaceSymbols(context.Background(), "area")
+	if len(got) != 2 {
+		t.Fatalf("GetWorkspaceSymbols = %v, want the method and the spell", got)
+	}
+
+	// The exact match ranks first
+	if got[0].Name != "area" || got[0].ContainerName != "Shape" || got[0].Kind != lsp.SymbolKindMethod {
+		t.Errorf("first match = %v, want the area method of Shape", got[0])
+	}
+	if got[1].Name != "µarea" || got[1].Location.URI != w.uri("sizes.crl") {
+		t.Errorf("second match = %v, want the µarea spell", got[1])
+	}
+
+	// µ is one UTF-16 code unit but two bytes
+	want := lsp.Range{Start: lsp.Position{Line: 0, Character: 6}, End: lsp.Position{Line: 0, Character: 11}}
+	if got[1].Location.Range != want {
+		t.Errorf("µarea range = %v, want %v", got[1].Location.Range, want)
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.lsp.dev/jsonrpc2"
+)
+
+// CodeRequestCancelled is the error code the LSP spec defines for calls the
+// client cancelled
+const CodeRequestCancelled = -32800
+
+// cancellable gives a call a context that $/cancelRequest cancels, until the
+// returned replier answers it. A call cancelled before it is answered gets
+// the RequestCancelled error, whatever its handler returned.
+func (h *Handler) cancellable(
+	ctx context.Context,
+	req jsonrpc2.Request,
+	reply jsonrpc2.Replier,
+) (context.Context, jsonrpc2.Replier) {
+	call, ok := req.(*jsonrpc2.Call)
+	if !ok {
+		return ctx, reply
+	}
+
+	callCtx, cancel := context.WithCancel(ctx)
+	id := call.ID()
+	h.callsMu.Lock()
+	h.calls[id] = cancel
+	h.callsMu.Unlock()
+
+	return callCtx, func(_ context.Context, result interface{}, err error) error {
+		h.callsMu.Lock()
+		delete(h.calls, id)
+		h.callsMu.Unlock()
+
+		if callCtx.Err() != nil {
+			h.logger.Debug("Request cancelled: %s", req.Method())
+			result = nil
+			err = &jsonrpc2.Error{Code: CodeRequestCancelled, Message: "request cancelled"}
+		}
+		cancel()
+
+		// The reply is written with the context of the connection, as writing
+		// fails once the context of the call is cancelled
+		return reply(ctx, result, err)
+	}
+}
+
+// handleCancelRequest cancels the context of the call a $/cancelRequest
+// notification names. Calls already answered are left alone.
+func (h *Handler) handleCancelRequest(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params struct {
+		ID jsonrpc2.ID `json:"id"`
+	}
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.callsMu.Lock()
+	cancel, ok := h.calls[params.ID]
+	h.callsMu.Unlock()
+	if ok {
+		h.logger.Debug("Cancelling request %v", params.ID)
+		cancel()
+	}
+	return nil, nil
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/jsonrpc2"
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/carrionlang-lsp/lsp/internal/util"
+)
+
+func TestCancelRenameInFlight(t *testing.T) {
+	// Renaming first indexes the files that were never opened, which takes
+	// a while in a large workspace
+	root := t.TempDir()
+	var content strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&content, "spell helper%d(value):\n    return value + %d\n\n", i, i)
+	}
+	for i := 0; i < 500; i++ {
+		path := filepath.Join(root, fmt.Sprintf("file%d.crl", i))
+		if err := os.WriteFile(path, []byte(content.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The client writes messages itself, so that the cancellation is only
+	// sent once the server has read the rename
+	ctx := context.Background()
+	serverPipe, clientPipe := net.Pipe()
+	server := jsonrpc2.NewConn(jsonrpc2.NewStream(serverPipe))
+	server.Go(ctx, NewHandler(util.NewLogger(util.StderrLogger{}), server).Serve)
+	client := jsonrpc2.NewStream(clientPipe)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	// Messages are read as they come, as the server waits for each of its
+	// messages to be read before reading the next message of the client
+	responses := make(chan *jsonrpc2.Response, 10)
+	go func() {
+		defer close(responses)
+		for {
+			msg, _, err := client.Read(ctx)
+			if err != nil {
+				return
+			}
+			if resp, ok := msg.(*jsonrpc2.Response); ok {
+				responses <- resp
+			}
+		}
+	}()
+
+	write := func(msg jsonrpc2.Message, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Write(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	response := func(id jsonrpc2.ID) *jsonrpc2.Response {
+		t.Helper()
+		resp, ok := <-responses
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		if resp.ID() != id {
+			t.Fatalf("got the response to %v, want the one to %v", resp.ID(), id)
+		}
+		return resp
+	}
+
+	doc := uri.File(filepath.Join(root, "main.crl"))
+	write(jsonrpc2.NewCall(jsonrpc2.NewNumberID(1), "initialize", lsp.InitializeParams{RootURI: uri.File(root)}))
+	if err := response(jsonrpc2.NewNumberID(1)).Err(); err != nil {
+		t.Fatal(err)
+	}
+	write(jsonrpc2.NewNotification("textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: doc, LanguageID: "carrion", Version: 1, Text: "count = 1\nprint(count)\n"},
+	}))
+
+	write(jsonrpc2.NewCall(jsonrpc2.NewNumberID(2), "textDocument/rename", lsp.RenameParams{
+		TextDocumentPositionParams: lsp.TextDocumentPositionParams{TextDocument: lsp.TextDocumentIdentifier{URI: doc}},
+		NewName:                    "total",
+	}))
+	write(jsonrpc2.NewNotification("$/cancelRequest", map[string]interface{}{"id": 2}))
+
+	var rpcErr *jsonrpc2.Error
+	if err := response(jsonrpc2.NewNumberID(2)).Err(); !errors.As(err, &rpcErr) || rpcErr.Code != CodeRequestCancelled {
+		t.Errorf("rename answered with error %v, want the RequestCancelled error", err)
+	}
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/carrionlang-lsp/lsp/internal/analyzer"
+	"github.com/carrionlang-lsp/lsp/internal/protocol"
+
+	"go.lsp.dev/jsonrpc2"
+	lsp "go.lsp.dev/protocol"
+)
+
+// defaultDiagnosticsDelay is how long the analysis of a changed document
+// waits for further changes, unless the client settings say otherwise
+const defaultDiagnosticsDelay = 300 * time.Millisecond
+
+// pendingAnalysis is the analysis of a changed document waiting for its
+// delay to pass. Its context is cancelled when a later change supersedes it
+// or it runs early.
+type pendingAnalysis struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+}
+
+// scheduleAnalysis analyzes a changed document and publishes its diagnostics
+// once no further change arrives for the diagnostics delay, superseding the
+// analysis pending for an earlier change. Called with h.mu held.
+func (h *Handler) scheduleAnalysis(ctx context.Context, uri lsp.DocumentURI) {
+	h.cancelAnalysis(uri)
+	if h.diagnosticsDelay <= 0 {
+		h.analyze(ctx, uri)
+		return
+	}
+
+	pendingCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	pending := &pendingAnalysis{ctx: pendingCtx, cancel: cancel}
+	pending.timer = time.AfterFunc(h.diagnosticsDelay, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		// A change or request may have got the lock first
+		if pendingCtx.Err() != nil {
+			return
+		}
+		h.runAnalysis(uri)
+	})
+	h.analyses[uri] = pending
+}
+
+// cancelAnalysis drops the analysis pending for a document, if any. Called
+// with h.mu held.
+func (h *Handler) cancelAnalysis(uri lsp.DocumentURI) {
+	pending, ok := h.analyses[uri]
+	if !ok {
+		return
+	}
+	pending.timer.Stop()
+	pending.cancel()
+	delete(h.analyses, uri)
+}
+
+// flushAnalyses runs the pending analyses at once, so that a request sees
+// every change made before it. Called with h.mu held.
+func (h *Handler) flushAnalyses() {
+	for uri := range h.analyses {
+		h.runAnalysis(uri)
+	}
+}
+
+// flushAnalysis runs the analysis pending for a document at once, if any,
+// so that a request reading the document sees every change made to it.
+// Called with h.mu held.
+func (h *Handler) flushAnalysis(uri lsp.DocumentURI) {
+	if _, ok := h.analyses[uri]; ok {
+		h.runAnalysis(uri)
+	}
+}
+
+// runAnalysis runs the analysis pending for a document. A change to the
+// document stops it with stopAnalysis while it runs, in which case it is
+// pending again. Called with h.mu held.
+func (h *Handler) runAnalysis(uri lsp.DocumentURI) {
+	pending := h.analyses[uri]
+	h.cancelAnalysis(uri)
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(pending.ctx))
+	h.runningMu.Lock()
+	h.running[uri] = cancel
+	h.runningMu.Unlock()
+	defer func() {
+		h.runningMu.Lock()
+		delete(h.running, uri)
+		h.runningMu.Unlock()
+		cancel()
+	}()
+
+	if !h.analyze(ctx, uri) {
+		h.scheduleAnalysis(context.WithoutCancel(pending.ctx), uri)
+	}
+}
+
+// stopAnalysis stops the analysis running for a document, if any, as a
+// change to the document supersedes it. It does not wait for h.mu, which the
+// running analysis holds.
+func (h *Handler) stopAnalysis(uri lsp.DocumentURI) {
+	h.runningMu.Lock()
+	defer h.runningMu.Unlock()
+	if cancel, ok := h.running[uri]; ok {
+		cancel()
+	}
+}
+
+// analyze analyzes the current version of a document and publishes its
+// diagnostics, reporting false when ctx was cancelled first. Called with h.mu
+// held, which keeps the diagnostics of an earlier version from being
+// published after those of a later one.
+func (h *Handler) analyze(ctx context.Context, uri lsp.DocumentURI) bool {
+	diagnostics, err := h.analyzer.AnalyzeDocument(ctx, uri)
+	if err != nil {
+		h.logger.Debug("Analysis of %s stopped: %v", uri, err)
+		return false
+	}
+
+	var version int32
+	if snapshot := h.analyzer.Snapshot(uri); snapshot != nil {
+		version = snapshot.Document.Version
+	}
+	h.sendDiagnostics(context.WithoutCancel(ctx), uri, version, diagnostics)
+
+	if h.staleAnswers[uri] {
+		delete(h.staleAnswers, uri)
+		h.refreshStaleAnswers(context.WithoutCancel(ctx))
+	}
+	return true
+}
+
+// answersFromSnapshot reports whether a read-only request is answered from
+// the latest snapshot of its document, leaving the analysis pending for the
+// document to its delay. Editors send these requests as the user types, and
+// ask for them again when refreshed, so only clients accepting to refresh
+// them get answers that lag behind the document.
+func (h *Handler) answersFromSnapshot(method string) bool {
+	switch method {
+	case "textDocument/semanticTokens/full",
+		"textDocument/semanticTokens/full/delta",
+		"textDocument/semanticTokens/range":
+		return h.semanticTokensRefresh
+	case "textDocument/inlayHint":
+		return h.inlayHintRefresh
+	case "textDocument/diagnostic":
+		return h.diagnosticRefresh
+	}
+	return false
+}
+
+// refreshStaleAnswers asks the client to request again what may have been
+// answered from the snapshot of an earlier version of a document
+func (h *Handler) refreshStaleAnswers(ctx context.Context) {
+	if h.semanticTokensRefresh {
+		go h.refreshSemanticTokens(ctx)
+	}
+	if h.inlayHintRefresh {
+		go h.refreshInlayHints(ctx)
+	}
+	if h.diagnosticRefresh {
+		go h.refreshDiagnostics(ctx)
+	}
+}
+
+// handleTextDocumentDiagnostic answers a pull of the diagnostics of a
+// document, saying they are unchanged when the client holds them already
+func (h *Handler) handleTextDocumentDiagnostic(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params protocol.DocumentDiagnosticParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Diagnostics requested for %s", params.TextDocument.URI)
+
+	file := h.analysis(ctx).DocumentDiagnostics(params.TextDocument.URI)
+	if file.ResultID != "" && file.ResultID == params.PreviousResultID {
+		return protocol.UnchangedDocumentDiagnosticReport{
+			Kind:     protocol.DocumentDiagnosticReportKindUnchanged,
+			ResultID: file.ResultID,
+		}, nil
+	}
+	return protocol.FullDocumentDiagnosticReport{
+		Kind:     protocol.DocumentDiagnosticReportKindFull,
+		ResultID: file.ResultID,
+		Items:    file.Diagnostics,
+	}, nil
+}
+
+// handleWorkspaceDiagnostic answers a pull of the diagnostics of the files
+// that are not open. Files the client holds diagnostics for that are gone get
+// an empty report.
+func (h *Handler) handleWorkspaceDiagnostic(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params protocol.WorkspaceDiagnosticParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Workspace diagnostics requested")
+
+	analysis := h.analysis(ctx)
+	files := analysis.WorkspaceDiagnostics(ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	previous := make(map[lsp.DocumentURI]string, len(params.PreviousResultIDs))
+	for _, id := range params.PreviousResultIDs {
+		previous[id.URI] = id.Value
+	}
+
+	report := protocol.WorkspaceDiagnosticReport{Items: make([]interface{}, 0, len(files))}
+	for _, file := range files {
+		report.Items = append(report.Items, workspaceDiagnosticReport(file, previous[file.URI]))
+		delete(previous, file.URI)
+	}
+	for uri, resultID := range previous {
+		if analysis.Document(uri) == nil {
+			report.Items = append(report.Items, workspaceDiagnosticReport(analysis.DocumentDiagnostics(uri), resultID))
+		}
+	}
+	return report, nil
+}
+
+// workspaceDiagnosticReport reports the diagnostics of a file that is not
+// open, saying they are unchanged when the client holds them already
+func workspaceDiagnosticReport(file analyzer.FileDiagnostics, previousResultID string) interface{} {
+	if file.ResultID != "" && file.ResultID == previousResultID {
+		return protocol.WorkspaceUnchangedDocumentDiagnosticReport{
+			UnchangedDocumentDiagnosticReport: protocol.UnchangedDocumentDiagnosticReport{
+				Kind:     protocol.DocumentDiagnosticReportKindUnchanged,
+				ResultID: file.ResultID,
+			},
+			URI: file.URI,
+		}
+	}
+	return protocol.WorkspaceFullDocumentDiagnosticReport{
+		FullDocumentDiagnosticReport: protocol.FullDocumentDiagnosticReport{
+			Kind:     protocol.DocumentDiagnosticReportKindFull,
+			ResultID: file.ResultID,
+			Items:    file.Diagnostics,
+		},
+		URI: file.URI,
+	}
+}
+
+// refreshSemanticTokens asks the client to request the semantic tokens of
+// open documents again
+func (h *Handler) refreshSemanticTokens(ctx context.Context) {
+	if _, err := h.conn.Call(ctx, "workspace/semanticTokens/refresh", nil, nil); err != nil {
+		h.logger.Warn("Failed to refresh semantic tokens: %v", err)
+	}
+}
+
+// refreshDiagnostics asks the client to pull diagnostics again
+func (h *Handler) refreshDiagnostics(ctx context.Context) {
+	if _, err := h.conn.Call(ctx, "workspace/diagnostic/refresh", nil, nil); err != nil {
+		h.logger.Warn("Failed to refresh diagnostics: %v", err)
+	}
+}
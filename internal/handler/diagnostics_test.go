@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	lsp "go.lsp.dev/protocol"
+)
+
+func TestReadsRunOnlyTheAnalysisOfTheirDocument(t *testing.T) {
+	const a, b = lsp.DocumentURI("file:///a.crl"), lsp.DocumentURI("file:///b.crl")
+
+	var mu sync.Mutex
+	published := make(map[lsp.DocumentURI]uint32)
+	refreshed := make(chan struct{}, 1)
+	_, client := newTestServer(t, func(req jsonrpc2.Request) {
+		switch req.Method() {
+		case "textDocument/publishDiagnostics":
+			var params lsp.PublishDiagnosticsParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			published[params.URI] = params.Version
+			mu.Unlock()
+		case "workspace/semanticTokens/refresh":
+			refreshed <- struct{}{}
+		}
+	})
+	version := func(uri lsp.DocumentURI) uint32 {
+		mu.Lock()
+		defer mu.Unlock()
+		return published[uri]
+	}
+
+	// The delay is long enough for the analyses to only run when requested
+	var result interface{}
+	call(t, client, "initialize", map[string]interface{}{
+		"initializationOptions": map[string]interface{}{
+			"diagnostics": map[string]interface{}{"delay": 60000},
+		},
+		"capabilities": map[string]interface{}{
+			"workspace": map[string]interface{}{
+				"semanticTokens": map[string]interface{}{"refreshSupport": true},
+			},
+		},
+	}, &result)
+	openDocument(t, client, a, "x = 1\n")
+	openDocument(t, client, b, "y = 1\n")
+	changeDocument(t, client, a, 2, "x = 2\n")
+	changeDocument(t, client, b, 2, "y = 2\n")
+
+	hover := func(uri lsp.DocumentURI) {
+		call(t, client, "textDocument/hover", lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		}, &result)
+	}
+
+	hover(b)
+	if version(b) != 2 || version(a) != 1 {
+		t.Errorf("after a hover in b, published versions are a:%d b:%d, want a:1 b:2", version(a), version(b))
+	}
+
+	call(t, client, "textDocument/semanticTokens/full", lsp.SemanticTokensParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: a},
+	}, &result)
+	if version(a) != 1 {
+		t.Errorf("semantic tokens ran the analysis of a")
+	}
+	select {
+	case <-refreshed:
+		t.Error("semantic tokens refreshed before a was analyzed")
+	default:
+	}
+
+	hover(a)
+	if version(a) != 2 {
+		t.Errorf("after a hover in a, its published version is %d, want 2", version(a))
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Error("semantic tokens answered from an earlier version were not refreshed")
+	}
+}
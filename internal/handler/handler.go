@@ -3,7 +3,10 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/carrionlang-lsp/lsp/internal/analyzer"
 	"github.com/carrionlang-lsp/lsp/internal/formatter"
@@ -16,6 +19,7 @@ import (
 
 // ErrorCodes defined in the JSON-RPC spec
 const (
+	CodeInvalidParams  = -32602
 	CodeMethodNotFound = -32601
 )
 
@@ -25,9 +29,53 @@ type Handler struct {
 	documentStore *protocol.CarrionDocumentStore
 	analyzer      *analyzer.CarrionAnalyzer
 	formatter     *formatter.CarrionFormatter
-	capabilities  lsp.ServerCapabilities
+	capabilities  protocol.ServerCapabilities
 	workspace     lsp.WorkspaceFolder
 	initialized   bool
+
+	// mu guards the analyzer and the handler state. Read-only requests only
+	// hold it to get their view of the analyzer, while changes and the
+	// background workspace indexer hold it as long as they run.
+	mu               sync.Mutex
+	workDoneProgress bool
+	watchFiles       bool
+	cancelIndex      context.CancelFunc
+	// foldingRangeLimit is the number of folding ranges the client prefers
+	// per document, 0 when it has no preference
+	foldingRangeLimit int
+	// inlayHintRefresh is set when the client accepts requests to refresh
+	// its inlay hints
+	inlayHintRefresh bool
+	// pullDiagnostics is set when the client requests diagnostics, which are
+	// then not published
+	pullDiagnostics bool
+	// diagnosticRefresh is set when the client accepts requests to pull
+	// diagnostics again
+	diagnosticRefresh bool
+	// semanticTokensRefresh is set when the client accepts requests to
+	// refresh its semantic tokens
+	semanticTokensRefresh bool
+	// diagnosticsDelay is how long the analysis of a changed document waits
+	// for further changes
+	diagnosticsDelay time.Duration
+	// analyses holds the analyses of changed documents waiting for the delay
+	analyses map[lsp.DocumentURI]*pendingAnalysis
+	// staleAnswers holds the documents with requests answered from the
+	// snapshot of an earlier version, which the client is asked to make again
+	// once the document is analyzed
+	staleAnswers map[lsp.DocumentURI]bool
+
+	// runningMu guards running. It is not mu, which running analyses hold,
+	// so that a change can stop the analysis it supersedes.
+	runningMu sync.Mutex
+	// running holds the functions stopping the analyses being run, by document
+	running map[lsp.DocumentURI]context.CancelFunc
+
+	// callsMu guards calls. It is not mu, so that a cancellation does not
+	// wait for the changes being made.
+	callsMu sync.Mutex
+	// calls holds the functions cancelling the calls being answered, by id
+	calls map[jsonrpc2.ID]context.CancelFunc
 }
 
 func NewHandler(logger *util.Logger, conn jsonrpc2.Conn) *Handler {
@@ -42,19 +90,195 @@ func NewHandler(logger *util.Logger, conn jsonrpc2.Conn) *Handler {
 		analyzer:      analyzer,
 		formatter:     formatter,
 		initialized:   false,
+
+		diagnosticsDelay: defaultDiagnosticsDelay,
+		analyses:         make(map[lsp.DocumentURI]*pendingAnalysis),
+		staleAnswers:     make(map[lsp.DocumentURI]bool),
+		running:          make(map[lsp.DocumentURI]context.CancelFunc),
+		calls:            make(map[jsonrpc2.ID]context.CancelFunc),
 	}
 }
 
-// Handle implements jsonrpc2.Handler interface
+// readOnlyMethods are the requests that only read the analyzer and the
+// handler state, which may be answered concurrently. Rename is not one of
+// them, as it indexes the unopened files its references may live in.
+var readOnlyMethods = map[string]bool{
+	"textDocument/completion":                true,
+	"textDocument/formatting":                true,
+	"textDocument/definition":                true,
+	"textDocument/hover":                     true,
+	"textDocument/signatureHelp":             true,
+	"textDocument/references":                true,
+	"textDocument/documentHighlight":         true,
+	"textDocument/documentSymbol":            true,
+	"textDocument/prepareRename":             true,
+	"textDocument/prepareCallHierarchy":      true,
+	"callHierarchy/incomingCalls":            true,
+	"callHierarchy/outgoingCalls":            true,
+	"textDocument/prepareTypeHierarchy":      true,
+	"typeHierarchy/supertypes":               true,
+	"typeHierarchy/subtypes":                 true,
+	"textDocument/codeAction":                true,
+	"codeAction/resolve":                     true,
+	"textDocument/foldingRange":              true,
+	"textDocument/selectionRange":            true,
+	"textDocument/semanticTokens/full":       true,
+	"textDocument/semanticTokens/full/delta": true,
+	"textDocument/semanticTokens/range":      true,
+	"textDocument/inlayHint":                 true,
+	"textDocument/diagnostic":                true,
+	"workspace/symbol":                       true,
+	"workspace/diagnostic":                   true,
+}
+
+// backgroundMethods are the requests changing the analyzer that may run long.
+// They are answered in their own goroutine, so that the $/cancelRequest
+// cancelling them can be read while they run.
+var backgroundMethods = map[string]bool{
+	"textDocument/rename": true,
+}
+
+// Serve implements jsonrpc2.Handler. Read-only requests are answered in their
+// own goroutine so that they run concurrently, from a view of the analyzer
+// taken before the next message is read: they see every earlier change and
+// none of the later ones, which do not wait for them. Other messages are
+// handled in order as they arrive; background requests take h.mu before the
+// next message is read, so later messages still wait for them. Calls can be
+// cancelled with $/cancelRequest until they are answered.
+func (h *Handler) Serve(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	if req.Method() == "$/cancelRequest" {
+		_, err := h.handleCancelRequest(ctx, req)
+		return reply(ctx, nil, err)
+	}
+	ctx, reply = h.cancellable(ctx, req, reply)
+
+	switch req.Method() {
+	case "textDocument/didChange", "textDocument/didClose":
+		if uri, ok := targetDocument(req); ok {
+			h.stopAnalysis(uri)
+		}
+	}
+
+	if backgroundMethods[req.Method()] {
+		h.mu.Lock()
+		go func() {
+			result, err := h.handleChange(ctx, req)
+			h.mu.Unlock()
+			if err := reply(ctx, result, err); err != nil {
+				h.logger.Error("Failed to reply to %s: %v", req.Method(), err)
+			}
+		}()
+		return nil
+	}
+
+	if !readOnlyMethods[req.Method()] {
+		result, err := h.Handle(ctx, req)
+		return reply(ctx, result, err)
+	}
+
+	ctx, err := h.prepareRead(ctx, req)
+	if err != nil {
+		return reply(ctx, nil, err)
+	}
+
+	go func() {
+		result, err := h.handle(ctx, req)
+		if err := reply(ctx, result, err); err != nil {
+			h.logger.Error("Failed to reply to %s: %v", req.Method(), err)
+		}
+	}()
+	return nil
+}
+
+// Handle handles a request and returns its result
 func (h *Handler) Handle(
 	ctx context.Context,
 	req jsonrpc2.Request,
 ) (result interface{}, err error) {
+	if readOnlyMethods[req.Method()] {
+		ctx, err := h.prepareRead(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return h.handle(ctx, req)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.handleChange(ctx, req)
+}
+
+// handleChange handles a request that is not read-only. Called with h.mu held.
+func (h *Handler) handleChange(ctx context.Context, req jsonrpc2.Request) (interface{}, error) {
+	if err := h.checkInitialized(req); err != nil {
+		return nil, err
+	}
+	return h.handle(ctx, req)
+}
+
+// analysisKey is the context key of the view of the analyzer a read-only
+// request reads from
+type analysisKey struct{}
+
+// prepareRead runs the pending analyses a read-only request needs to see the
+// changes made before it, and gives the request the view of the analyzer it
+// reads from. Requests about a document only need the analysis of that
+// document, unless they are answered from its latest snapshot.
+func (h *Handler) prepareRead(ctx context.Context, req jsonrpc2.Request) (context.Context, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.checkInitialized(req); err != nil {
+		return ctx, err
+	}
+	if uri, ok := targetDocument(req); !ok {
+		h.flushAnalyses()
+	} else if !h.answersFromSnapshot(req.Method()) {
+		h.flushAnalysis(uri)
+	} else if _, pending := h.analyses[uri]; pending {
+		h.staleAnswers[uri] = true
+	}
+	return context.WithValue(ctx, analysisKey{}, h.analyzer.View()), nil
+}
+
+// targetDocument returns the document a request is about, if any
+func targetDocument(req jsonrpc2.Request) (lsp.DocumentURI, bool) {
+	var params struct {
+		TextDocument struct {
+			URI lsp.DocumentURI `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if err := json.Unmarshal(req.Params(), &params); err != nil || params.TextDocument.URI == "" {
+		return "", false
+	}
+	return params.TextDocument.URI, true
+}
+
+// checkInitialized rejects requests made before initialize
+func (h *Handler) checkInitialized(req jsonrpc2.Request) error {
 	h.logger.Debug("Received request: %s", req.Method())
 
 	// Allow initialize even if not initialized yet
 	if !h.initialized && req.Method() != "initialize" {
-		return nil, fmt.Errorf("server not initialized")
+		return fmt.Errorf("server not initialized")
+	}
+	return nil
+}
+
+// analysis returns the analyzer a request reads from: the view it was given,
+// or the analyzer itself for requests changing it
+func (h *Handler) analysis(ctx context.Context) *analyzer.CarrionAnalyzer {
+	if view, ok := ctx.Value(analysisKey{}).(*analyzer.CarrionAnalyzer); ok {
+		return view
+	}
+	return h.analyzer
+}
+
+// handle dispatches a request to the handler of its method
+func (h *Handler) handle(ctx context.Context, req jsonrpc2.Request) (interface{}, error) {
+	// A call cancelled while it waited is not worth starting
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	switch req.Method() {
@@ -82,6 +306,56 @@ func (h *Handler) Handle(
 		return h.handleTextDocumentHover(ctx, req)
 	case "textDocument/signatureHelp":
 		return h.handleTextDocumentSignatureHelp(ctx, req)
+	case "textDocument/references":
+		return h.handleTextDocumentReferences(ctx, req)
+	case "textDocument/documentHighlight":
+		return h.handleTextDocumentDocumentHighlight(ctx, req)
+	case "textDocument/documentSymbol":
+		return h.handleTextDocumentDocumentSymbol(ctx, req)
+	case "textDocument/prepareRename":
+		return h.handleTextDocumentPrepareRename(ctx, req)
+	case "textDocument/rename":
+		return h.handleTextDocumentRename(ctx, req)
+	case "textDocument/prepareCallHierarchy":
+		return h.handleTextDocumentPrepareCallHierarchy(ctx, req)
+	case "callHierarchy/incomingCalls":
+		return h.handleCallHierarchyIncomingCalls(ctx, req)
+	case "callHierarchy/outgoingCalls":
+		return h.handleCallHierarchyOutgoingCalls(ctx, req)
+	case "textDocument/prepareTypeHierarchy":
+		return h.handleTextDocumentPrepareTypeHierarchy(ctx, req)
+	case "typeHierarchy/supertypes":
+		return h.handleTypeHierarchySupertypes(ctx, req)
+	case "typeHierarchy/subtypes":
+		return h.handleTypeHierarchySubtypes(ctx, req)
+	case "textDocument/codeAction":
+		return h.handleTextDocumentCodeAction(ctx, req)
+	case "codeAction/resolve":
+		return h.handleCodeActionResolve(ctx, req)
+	case "textDocument/foldingRange":
+		return h.handleTextDocumentFoldingRange(ctx, req)
+	case "textDocument/selectionRange":
+		return h.handleTextDocumentSelectionRange(ctx, req)
+	case "textDocument/semanticTokens/full":
+		return h.handleSemanticTokensFull(ctx, req)
+	case "textDocument/semanticTokens/full/delta":
+		return h.handleSemanticTokensFullDelta(ctx, req)
+	case "textDocument/semanticTokens/range":
+		return h.handleSemanticTokensRange(ctx, req)
+	case "textDocument/inlayHint":
+		return h.handleTextDocumentInlayHint(ctx, req)
+	case "workspace/symbol":
+		return h.handleWorkspaceSymbol(ctx, req)
+	case "textDocument/diagnostic":
+		return h.handleTextDocumentDiagnostic(ctx, req)
+	case "workspace/diagnostic":
+		return h.handleWorkspaceDiagnostic(ctx, req)
+	case "workspace/didChangeWatchedFiles":
+		return h.handleWorkspaceDidChangeWatchedFiles(ctx, req)
+	case "workspace/didChangeConfiguration":
+		return h.handleWorkspaceDidChangeConfiguration(ctx, req)
+	case "$/cancelRequest":
+		return h.handleCancelRequest(ctx, req)
 	default:
 		h.logger.Warn("Unsupported method: %s", req.Method())
 		return nil, &jsonrpc2.Error{
@@ -106,11 +380,58 @@ func (h *Handler) handleInitialize(
 		h.workspace = params.WorkspaceFolders[0]
 	}
 
+	folders := make([]lsp.DocumentURI, 0, len(params.WorkspaceFolders))
+	for _, folder := range params.WorkspaceFolders {
+		folders = append(folders, lsp.DocumentURI(folder.URI))
+	}
+	if len(folders) == 0 && params.RootURI != "" {
+		folders = append(folders, params.RootURI)
+	}
+	h.analyzer.SetWorkspaceFolders(folders)
+
+	if params.Capabilities.Window != nil {
+		h.workDoneProgress = params.Capabilities.Window.WorkDoneProgress
+	}
+	if textDocument := params.Capabilities.TextDocument; textDocument != nil && textDocument.CodeAction != nil {
+		codeAction := textDocument.CodeAction
+		resolveEdits := false
+		if codeAction.ResolveSupport != nil {
+			for _, property := range codeAction.ResolveSupport.Properties {
+				resolveEdits = resolveEdits || property == "edit"
+			}
+		}
+		h.analyzer.SetCodeActionResolveSupport(codeAction.DataSupport && resolveEdits)
+	}
+	if textDocument := params.Capabilities.TextDocument; textDocument != nil && textDocument.FoldingRange != nil {
+		h.foldingRangeLimit = int(textDocument.FoldingRange.RangeLimit)
+	}
+	if workspace := params.Capabilities.Workspace; workspace != nil && workspace.DidChangeWatchedFiles != nil {
+		h.watchFiles = workspace.DidChangeWatchedFiles.DynamicRegistration
+	}
+
+	var extensions initializeExtensions
+	if err := json.Unmarshal(req.Params(), &extensions); err != nil {
+		return nil, err
+	}
+	if inlayHint := extensions.Capabilities.Workspace.InlayHint; inlayHint != nil {
+		h.inlayHintRefresh = inlayHint.RefreshSupport
+	}
+	h.pullDiagnostics = extensions.Capabilities.TextDocument.Diagnostic != nil
+	if diagnostics := extensions.Capabilities.Workspace.Diagnostics; diagnostics != nil {
+		h.diagnosticRefresh = diagnostics.RefreshSupport
+	}
+	if workspace := params.Capabilities.Workspace; workspace != nil && workspace.SemanticTokens != nil {
+		h.semanticTokensRefresh = workspace.SemanticTokens.RefreshSupport
+	}
+	if extensions.InitializationOptions != nil {
+		h.applySettings(*extensions.InitializationOptions)
+	}
+
 	// Set server capabilities
-	h.capabilities = lsp.ServerCapabilities{
+	h.capabilities.ServerCapabilities = lsp.ServerCapabilities{
 		TextDocumentSync: &lsp.TextDocumentSyncOptions{
 			OpenClose: true,
-			Change:    lsp.TextDocumentSyncKindFull, // We currently only support full syncs
+			Change:    lsp.TextDocumentSyncKindIncremental,
 		},
 		CompletionProvider: &lsp.CompletionOptions{
 			TriggerCharacters: []string{".", ":"},
@@ -118,15 +439,44 @@ func (h *Handler) handleInitialize(
 		},
 		HoverProvider:              true,
 		DefinitionProvider:         true,
+		ReferencesProvider:         true,
+		DocumentHighlightProvider:  true,
+		DocumentSymbolProvider:     true,
+		WorkspaceSymbolProvider:    true,
 		DocumentFormattingProvider: true,
+		FoldingRangeProvider:       true,
+		SelectionRangeProvider:     true,
+		CallHierarchyProvider:      true,
 		SignatureHelpProvider: &lsp.SignatureHelpOptions{
 			TriggerCharacters: []string{"(", ","},
 		},
+		RenameProvider: &lsp.RenameOptions{
+			PrepareProvider: true,
+		},
+		CodeActionProvider: &lsp.CodeActionOptions{
+			CodeActionKinds: analyzer.CodeActionKinds(),
+			ResolveProvider: true,
+		},
+		SemanticTokensProvider: &protocol.SemanticTokensOptions{
+			Legend: analyzer.SemanticTokensLegend(),
+			Range:  true,
+			Full:   &protocol.SemanticTokensFullOptions{Delta: true},
+		},
+	}
+	h.capabilities.InlayHintProvider = true
+	h.capabilities.TypeHierarchyProvider = true
+	if h.pullDiagnostics {
+		// Diagnostics report names imported from other files
+		h.capabilities.DiagnosticProvider = &protocol.DiagnosticOptions{
+			Identifier:            "carrion",
+			InterFileDependencies: true,
+			WorkspaceDiagnostics:  true,
+		}
 	}
 
 	h.initialized = true
 
-	return lsp.InitializeResult{
+	return protocol.InitializeResult{
 		Capabilities: h.capabilities,
 		ServerInfo: &lsp.ServerInfo{
 			Name:    "carrion-language-server",
@@ -140,11 +490,27 @@ func (h *Handler) handleInitialized(
 	req jsonrpc2.Request,
 ) (interface{}, error) {
 	h.logger.Info("Server initialized")
+
+	// Index unopened files so cross-file features see the whole workspace
+	indexCtx, cancel := context.WithCancel(context.Background())
+	h.cancelIndex = cancel
+	go h.indexWorkspace(indexCtx)
+
+	if h.watchFiles {
+		go h.registerFileWatcher(indexCtx)
+	}
+
 	return nil, nil
 }
 
 func (h *Handler) handleShutdown(ctx context.Context, req jsonrpc2.Request) (interface{}, error) {
 	h.logger.Info("Shutting down")
+	if h.cancelIndex != nil {
+		h.cancelIndex()
+	}
+	for uri := range h.analyses {
+		h.cancelAnalysis(uri)
+	}
 	h.initialized = false
 	return nil, nil
 }
@@ -173,8 +539,8 @@ func (h *Handler) handleTextDocumentDidOpen(
 	)
 
 	// Run diagnostics on open
-	diagnostics := h.analyzer.AnalyzeDocument(params.TextDocument.URI)
-	h.sendDiagnostics(ctx, params.TextDocument.URI, diagnostics)
+	h.cancelAnalysis(params.TextDocument.URI)
+	h.analyze(ctx, params.TextDocument.URI)
 
 	return nil, nil
 }
@@ -183,21 +549,39 @@ func (h *Handler) handleTextDocumentDidChange(
 	ctx context.Context,
 	req jsonrpc2.Request,
 ) (interface{}, error) {
-	var params lsp.DidChangeTextDocumentParams
+	var params protocol.DidChangeTextDocumentParams
 	if err := json.Unmarshal(req.Params(), &params); err != nil {
 		return nil, err
 	}
 
 	h.logger.Debug("Document changed: %s", params.TextDocument.URI)
-	h.documentStore.UpdateDocument(
+	doc := h.documentStore.GetDocument(params.TextDocument.URI)
+	wasOutOfSync := doc != nil && doc.OutOfSync
+	_, err := h.documentStore.UpdateDocument(
 		params.TextDocument.URI,
 		params.ContentChanges,
 		params.TextDocument.Version,
 	)
+	switch {
+	case err == nil:
+	case wasOutOfSync:
+		// The user was told when the document went out of sync
+		h.logger.Debug("Dropped change: %v", err)
+		return nil, nil
+	default:
+		h.logger.Warn("Rejected change: %v", err)
+		if errors.Is(err, protocol.ErrDocumentOutOfSync) {
+			h.showMessage(
+				ctx,
+				lsp.MessageTypeWarning,
+				"Carrion: lost track of edits to "+string(params.TextDocument.URI)+", please reopen the file",
+			)
+		}
+		return nil, nil
+	}
 
-	// Run diagnostics on change
-	diagnostics := h.analyzer.AnalyzeDocument(params.TextDocument.URI)
-	h.sendDiagnostics(ctx, params.TextDocument.URI, diagnostics)
+	// Run diagnostics once typing pauses
+	h.scheduleAnalysis(ctx, params.TextDocument.URI)
 
 	return nil, nil
 }
@@ -212,10 +596,17 @@ func (h *Handler) handleTextDocumentDidClose(
 	}
 
 	h.logger.Debug("Document closed: %s", params.TextDocument.URI)
+	h.cancelAnalysis(params.TextDocument.URI)
+	delete(h.staleAnswers, params.TextDocument.URI)
 	h.documentStore.RemoveDocument(params.TextDocument.URI)
+	h.analyzer.DiscardSnapshot(params.TextDocument.URI)
+	h.analyzer.DiscardSemanticTokens(params.TextDocument.URI)
+
+	// Fall back to the saved content, or forget a file deleted while open
+	h.analyzer.ReindexFile(params.TextDocument.URI)
 
 	// Clear diagnostics for closed document
-	h.sendDiagnostics(ctx, params.TextDocument.URI, nil)
+	h.sendDiagnostics(ctx, params.TextDocument.URI, 0, nil)
 
 	return nil, nil
 }
@@ -234,7 +625,7 @@ func (h *Handler) handleTextDocumentCompletion(
 		params.Position,
 		params.TextDocument.URI,
 	)
-	completions := h.analyzer.GetCompletions(params.TextDocument.URI, params.Position)
+	completions := h.analysis(ctx).GetCompletions(params.TextDocument.URI, params.Position)
 
 	return completions, nil
 }
@@ -250,7 +641,7 @@ func (h *Handler) handleTextDocumentFormatting(
 
 	h.logger.Debug("Formatting requested for %s", params.TextDocument.URI)
 
-	doc := h.documentStore.GetDocument(params.TextDocument.URI)
+	doc := h.analysis(ctx).Document(params.TextDocument.URI)
 	if doc == nil {
 		return nil, fmt.Errorf("document not found: %s", params.TextDocument.URI)
 	}
@@ -274,7 +665,7 @@ func (h *Handler) handleTextDocumentDefinition(
 		params.TextDocument.URI,
 	)
 
-	locations := h.analyzer.FindDefinition(params.TextDocument.URI, params.Position)
+	locations := h.analysis(ctx).FindDefinition(params.TextDocument.URI, params.Position)
 	return locations, nil
 }
 
@@ -289,7 +680,7 @@ func (h *Handler) handleTextDocumentHover(
 
 	h.logger.Debug("Hover requested at position %v in %s", params.Position, params.TextDocument.URI)
 
-	hoverInfo := h.analyzer.GetHoverInfo(params.TextDocument.URI, params.Position)
+	hoverInfo := h.analysis(ctx).GetHoverInfo(params.TextDocument.URI, params.Position)
 	return hoverInfo, nil
 }
 
@@ -304,21 +695,445 @@ func (h *Handler) handleTextDocumentSignatureHelp(
 
 	h.logger.Debug("Signature help requested at position %v in %s", params.Position, params.TextDocument.URI)
 
-	signatureHelp := h.analyzer.GetSignatureHelp(params.TextDocument.URI, params.Position)
+	signatureHelp := h.analysis(ctx).GetSignatureHelp(params.TextDocument.URI, params.Position)
 	return signatureHelp, nil
 }
 
+func (h *Handler) handleTextDocumentReferences(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.ReferenceParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug(
+		"References requested at position %v in %s",
+		params.Position,
+		params.TextDocument.URI,
+	)
+
+	locations := h.analysis(ctx).FindReferences(
+		ctx,
+		params.TextDocument.URI,
+		params.Position,
+		params.Context.IncludeDeclaration,
+	)
+	return locations, nil
+}
+
+func (h *Handler) handleTextDocumentDocumentHighlight(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.DocumentHighlightParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug(
+		"Document highlights requested at position %v in %s",
+		params.Position,
+		params.TextDocument.URI,
+	)
+
+	highlights := h.analysis(ctx).GetDocumentHighlights(params.TextDocument.URI, params.Position)
+	return highlights, nil
+}
+
+func (h *Handler) handleTextDocumentDocumentSymbol(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.DocumentSymbolParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Document symbols requested for %s", params.TextDocument.URI)
+
+	documentSymbols := h.analysis(ctx).GetDocumentSymbols(params.TextDocument.URI)
+	return documentSymbols, nil
+}
+
+func (h *Handler) handleTextDocumentPrepareCallHierarchy(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.CallHierarchyPrepareParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug(
+		"Call hierarchy requested at position %v in %s",
+		params.Position,
+		params.TextDocument.URI,
+	)
+
+	items := h.analysis(ctx).PrepareCallHierarchy(params.TextDocument.URI, params.Position)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items, nil
+}
+
+func (h *Handler) handleCallHierarchyIncomingCalls(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.CallHierarchyIncomingCallsParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Incoming calls requested for %s in %s", params.Item.Name, params.Item.URI)
+
+	calls := h.analysis(ctx).GetIncomingCalls(ctx, params.Item)
+	return calls, nil
+}
+
+func (h *Handler) handleCallHierarchyOutgoingCalls(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.CallHierarchyOutgoingCallsParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Outgoing calls requested for %s in %s", params.Item.Name, params.Item.URI)
+
+	calls := h.analysis(ctx).GetOutgoingCalls(ctx, params.Item)
+	return calls, nil
+}
+
+func (h *Handler) handleTextDocumentPrepareTypeHierarchy(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params protocol.TypeHierarchyPrepareParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug(
+		"Type hierarchy requested at position %v in %s",
+		params.Position,
+		params.TextDocument.URI,
+	)
+
+	items := h.analysis(ctx).PrepareTypeHierarchy(params.TextDocument.URI, params.Position)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items, nil
+}
+
+func (h *Handler) handleTypeHierarchySupertypes(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params protocol.TypeHierarchySupertypesParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Supertypes requested for %s in %s", params.Item.Name, params.Item.URI)
+
+	items := h.analysis(ctx).GetSupertypes(params.Item)
+	return items, nil
+}
+
+func (h *Handler) handleTypeHierarchySubtypes(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params protocol.TypeHierarchySubtypesParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Subtypes requested for %s in %s", params.Item.Name, params.Item.URI)
+
+	items := h.analysis(ctx).GetSubtypes(ctx, params.Item)
+	return items, nil
+}
+
+func (h *Handler) handleTextDocumentCodeAction(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.CodeActionParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Code actions requested for %v in %s", params.Range, params.TextDocument.URI)
+
+	actions := h.analysis(ctx).GetCodeActions(params.TextDocument.URI, params.Range, params.Context)
+	return actions, nil
+}
+
+func (h *Handler) handleCodeActionResolve(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var action lsp.CodeAction
+	if err := json.Unmarshal(req.Params(), &action); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Code action resolve requested for %q", action.Title)
+
+	resolved, err := h.analysis(ctx).ResolveCodeAction(action)
+	if err != nil {
+		return nil, &jsonrpc2.Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return resolved, nil
+}
+
+func (h *Handler) handleTextDocumentFoldingRange(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.FoldingRangeParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Folding ranges requested for %s", params.TextDocument.URI)
+
+	ranges := h.analysis(ctx).GetFoldingRanges(params.TextDocument.URI, h.foldingRangeLimit)
+	return ranges, nil
+}
+
+func (h *Handler) handleTextDocumentSelectionRange(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.SelectionRangeParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Selection ranges requested at %v in %s", params.Positions, params.TextDocument.URI)
+
+	selections := h.analysis(ctx).GetSelectionRanges(params.TextDocument.URI, params.Positions)
+	return selections, nil
+}
+
+func (h *Handler) handleSemanticTokensFull(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.SemanticTokensParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Semantic tokens requested for %s", params.TextDocument.URI)
+
+	tokens := h.analysis(ctx).GetSemanticTokens(params.TextDocument.URI)
+	return tokens, nil
+}
+
+func (h *Handler) handleSemanticTokensFullDelta(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.SemanticTokensDeltaParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug(
+		"Semantic tokens delta requested for %s since %s",
+		params.TextDocument.URI,
+		params.PreviousResultID,
+	)
+
+	tokens := h.analysis(ctx).GetSemanticTokensDelta(params.TextDocument.URI, params.PreviousResultID)
+	return tokens, nil
+}
+
+func (h *Handler) handleSemanticTokensRange(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.SemanticTokensRangeParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Semantic tokens requested for %v in %s", params.Range, params.TextDocument.URI)
+
+	tokens := h.analysis(ctx).GetSemanticTokensRange(params.TextDocument.URI, params.Range)
+	return tokens, nil
+}
+
+func (h *Handler) handleTextDocumentInlayHint(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params protocol.InlayHintParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Inlay hints requested for %v in %s", params.Range, params.TextDocument.URI)
+
+	hints := h.analysis(ctx).GetInlayHints(params.TextDocument.URI, params.Range)
+	return hints, nil
+}
+
+func (h *Handler) handleWorkspaceSymbol(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.WorkspaceSymbolParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug("Workspace symbols requested for query %q", params.Query)
+
+	workspaceSymbols := h.analysis(ctx).GetWorkspaceSymbols(ctx, params.Query)
+	return workspaceSymbols, nil
+}
+
+func (h *Handler) handleWorkspaceDidChangeWatchedFiles(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.DidChangeWatchedFilesParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	for _, change := range params.Changes {
+		h.logger.Debug("Watched file %s: %s", change.Type, change.URI)
+		h.analyzer.ReindexFile(lsp.DocumentURI(change.URI))
+	}
+	if h.diagnosticRefresh {
+		go h.refreshDiagnostics(context.WithoutCancel(ctx))
+	}
+
+	return nil, nil
+}
+
+func (h *Handler) handleTextDocumentPrepareRename(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.PrepareRenameParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug(
+		"Prepare rename requested at position %v in %s",
+		params.Position,
+		params.TextDocument.URI,
+	)
+
+	symbolRange, err := h.analysis(ctx).PrepareRename(params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, &jsonrpc2.Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	if symbolRange == nil {
+		return nil, nil
+	}
+	return symbolRange, nil
+}
+
+func (h *Handler) handleTextDocumentRename(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params lsp.RenameParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	h.logger.Debug(
+		"Rename to %q requested at position %v in %s",
+		params.NewName,
+		params.Position,
+		params.TextDocument.URI,
+	)
+
+	// The edits are made to the latest version of every document
+	h.flushAnalyses()
+
+	edit, warnings, err := h.analyzer.Rename(ctx, params.TextDocument.URI, params.Position, params.NewName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &jsonrpc2.Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+
+	for _, warning := range warnings {
+		h.showMessage(ctx, lsp.MessageTypeWarning, "Carrion rename: "+warning)
+	}
+
+	if edit == nil {
+		return nil, nil
+	}
+	return edit, nil
+}
+
 func (h *Handler) sendDiagnostics(
 	ctx context.Context,
 	uri lsp.DocumentURI,
+	version int32,
 	diagnostics []lsp.Diagnostic,
 ) {
+	// Clients pulling diagnostics do not expect them to be published
+	if h.pullDiagnostics {
+		return
+	}
+
 	// Send diagnostics notification
 	err := h.conn.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
 		URI:         uri,
+		Version:     uint32(version),
 		Diagnostics: diagnostics,
 	})
 	if err != nil {
 		h.logger.Error("Failed to publish diagnostics: %v", err)
 	}
 }
+
+// registerFileWatcher asks the client to report changes to Carrion files made
+// outside the editor
+func (h *Handler) registerFileWatcher(ctx context.Context) {
+	_, err := h.conn.Call(ctx, "client/registerCapability", &lsp.RegistrationParams{
+		Registrations: []lsp.Registration{
+			{
+				ID:     "carrion/watchFiles",
+				Method: "workspace/didChangeWatchedFiles",
+				RegisterOptions: lsp.DidChangeWatchedFilesRegistrationOptions{
+					Watchers: []lsp.FileSystemWatcher{
+						{GlobPattern: "**/*.crl"},
+					},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		h.logger.Warn("Failed to register file watcher: %v", err)
+	}
+}
+
+func (h *Handler) showMessage(ctx context.Context, messageType lsp.MessageType, message string) {
+	err := h.conn.Notify(ctx, "window/showMessage", lsp.ShowMessageParams{
+		Type:    messageType,
+		Message: message,
+	})
+	if err != nil {
+		h.logger.Error("Failed to show message: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"go.lsp.dev/jsonrpc2"
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/util"
+)
+
+// newTestServer serves a handler on one end of a pipe and returns it along
+// with a client connected to the other end. Requests the server makes to the
+// client get a null result and are passed to onRequest, if given.
+func newTestServer(t *testing.T, onRequest func(req jsonrpc2.Request)) (*Handler, jsonrpc2.Conn) {
+	t.Helper()
+	ctx := context.Background()
+	serverPipe, clientPipe := net.Pipe()
+
+	client := jsonrpc2.NewConn(jsonrpc2.NewStream(clientPipe))
+	client.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if onRequest != nil {
+			onRequest(req)
+		}
+		return reply(ctx, nil, nil)
+	})
+
+	server := jsonrpc2.NewConn(jsonrpc2.NewStream(serverPipe))
+	h := NewHandler(util.NewLogger(util.StderrLogger{}), server)
+	server.Go(ctx, h.Serve)
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return h, client
+}
+
+// call makes a request and fails the test when it returns an error
+func call(t *testing.T, client jsonrpc2.Conn, method string, params, result interface{}) {
+	t.Helper()
+	if _, err := client.Call(context.Background(), method, params, result); err != nil {
+		t.Errorf("%s: %v", method, err)
+	}
+}
+
+// openDocument opens a document in an initialized server
+func openDocument(t *testing.T, client jsonrpc2.Conn, uri lsp.DocumentURI, text string) {
+	t.Helper()
+	err := client.Notify(context.Background(), "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: "carrion", Version: 1, Text: text},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// changeDocument replaces the content of an open document
+func changeDocument(t *testing.T, client jsonrpc2.Conn, uri lsp.DocumentURI, version int32, text string) {
+	t.Helper()
+	err := client.Notify(context.Background(), "textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+		"contentChanges": []map[string]interface{}{{"text": text}},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// TestConcurrentRequests reads a document from several clients while it is
+// edited and renamed in. Run it with -race.
+func TestConcurrentRequests(t *testing.T) {
+	const uri = lsp.DocumentURI("file:///stress.crl")
+	_, client := newTestServer(t, nil)
+	var result interface{}
+	call(t, client, "initialize", lsp.InitializeParams{}, &result)
+	openDocument(t, client, uri, "value = 1\nprint(value)\n")
+
+	document := lsp.TextDocumentIdentifier{URI: uri}
+	position := lsp.TextDocumentPositionParams{TextDocument: document, Position: lsp.Position{Line: 1, Character: 7}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				var result interface{}
+				call(t, client, "textDocument/hover", position, &result)
+				call(t, client, "textDocument/completion", lsp.CompletionParams{TextDocumentPositionParams: position}, &result)
+				call(t, client, "textDocument/references", lsp.ReferenceParams{TextDocumentPositionParams: position}, &result)
+				call(t, client, "textDocument/semanticTokens/full", lsp.SemanticTokensParams{TextDocument: document}, &result)
+				call(t, client, "textDocument/documentSymbol", lsp.DocumentSymbolParams{TextDocument: document}, &result)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 25; j++ {
+			var result interface{}
+			call(t, client, "textDocument/rename", lsp.RenameParams{
+				TextDocumentPositionParams: position,
+				NewName:                    fmt.Sprintf("renamed%d", j),
+			}, &result)
+		}
+	}()
+
+	for version := int32(2); version < 100; version++ {
+		changeDocument(t, client, uri, version, fmt.Sprintf("value = %d\nprint(value)\n", version))
+	}
+	wg.Wait()
+}
+
+func TestOutOfSyncDocumentWarnsOnce(t *testing.T) {
+	const uri = lsp.DocumentURI("file:///sync.crl")
+	var mu sync.Mutex
+	warnings := 0
+	_, client := newTestServer(t, func(req jsonrpc2.Request) {
+		if req.Method() == "window/showMessage" {
+			mu.Lock()
+			warnings++
+			mu.Unlock()
+		}
+	})
+	var result interface{}
+	call(t, client, "initialize", lsp.InitializeParams{}, &result)
+	openDocument(t, client, uri, "x = 1\n")
+
+	// Version 2 is lost, so the ranged changes that follow cannot be applied
+	for version := 3; version < 6; version++ {
+		err := client.Notify(context.Background(), "textDocument/didChange", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "version": version},
+			"contentChanges": []map[string]interface{}{{
+				"range": lsp.Range{Start: lsp.Position{Character: 5}, End: lsp.Position{Character: 5}},
+				"text":  "0",
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The reply follows the messages sent while handling the changes
+	call(t, client, "textDocument/hover", lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+	}, &result)
+	mu.Lock()
+	defer mu.Unlock()
+	if warnings != 1 {
+		t.Errorf("warned %d times, want once", warnings)
+	}
+}
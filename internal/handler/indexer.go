@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	lsp "go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+// maxIndexWorkers caps the number of files parsed concurrently by the workspace indexer
+const maxIndexWorkers = 4
+
+// indexProgressToken identifies the $/progress notifications of the workspace indexer
+const indexProgressToken = "carrion/indexWorkspace"
+
+// indexWorkspace parses every Carrion file in the workspace folders and adds
+// its symbols to the symbol table. Files are parsed in parallel, while the
+// symbol table is only updated under the handler lock.
+func (h *Handler) indexWorkspace(ctx context.Context) {
+	h.mu.Lock()
+	files := h.analyzer.WorkspaceFiles()
+	h.mu.Unlock()
+
+	if len(files) == 0 {
+		return
+	}
+
+	h.logger.Info("Indexing %d workspace files", len(files))
+	progress := h.beginProgress(ctx, "Indexing Carrion files", len(files))
+
+	paths := make(chan string)
+	var wg sync.WaitGroup
+	var indexed int
+
+	workers := maxIndexWorkers
+	if len(files) < workers {
+		workers = len(files)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				program, text := h.analyzer.ParseFile(path)
+
+				h.mu.Lock()
+				if program != nil {
+					h.analyzer.IndexProgram(uri.File(path), program, text)
+				}
+				indexed++
+				done := indexed
+				h.mu.Unlock()
+
+				progress.report(ctx, done)
+			}
+		}()
+	}
+
+feed:
+	for _, path := range files {
+		select {
+		case paths <- path:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(paths)
+	wg.Wait()
+
+	progress.end(ctx)
+	h.logger.Info("Finished indexing workspace")
+
+	// Diagnostics pulled during indexing missed the files indexed since
+	if h.diagnosticRefresh && ctx.Err() == nil {
+		h.refreshDiagnostics(ctx)
+	}
+}
+
+// indexProgress reports the progress of the workspace indexer to the client
+type indexProgress struct {
+	h           *Handler
+	enabled     bool
+	total       int
+	mu          sync.Mutex
+	lastPercent uint32
+}
+
+// beginProgress starts a work done progress, if the client supports them
+func (h *Handler) beginProgress(ctx context.Context, title string, total int) *indexProgress {
+	progress := &indexProgress{h: h, total: total}
+	if !h.workDoneProgress {
+		return progress
+	}
+
+	token := lsp.NewProgressToken(indexProgressToken)
+	if _, err := h.conn.Call(ctx, "window/workDoneProgress/create", &lsp.WorkDoneProgressCreateParams{
+		Token: *token,
+	}, nil); err != nil {
+		h.logger.Warn("Failed to create progress: %v", err)
+		return progress
+	}
+
+	progress.enabled = true
+	progress.notify(ctx, &lsp.WorkDoneProgressBegin{
+		Kind:       lsp.WorkDoneProgressKindBegin,
+		Title:      title,
+		Message:    fmt.Sprintf("0/%d files", total),
+		Percentage: 0,
+	})
+	return progress
+}
+
+// report publishes the number of files indexed so far, at most once per percent
+func (p *indexProgress) report(ctx context.Context, done int) {
+	if !p.enabled {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	percent := uint32(done * 100 / p.total)
+	if percent <= p.lastPercent && done != p.total {
+		return
+	}
+	p.lastPercent = percent
+
+	p.notify(ctx, &lsp.WorkDoneProgressReport{
+		Kind:       lsp.WorkDoneProgressKindReport,
+		Message:    fmt.Sprintf("%d/%d files", done, p.total),
+		Percentage: percent,
+	})
+}
+
+// end finishes the progress
+func (p *indexProgress) end(ctx context.Context) {
+	if !p.enabled {
+		return
+	}
+
+	p.notify(context.WithoutCancel(ctx), &lsp.WorkDoneProgressEnd{
+		Kind: lsp.WorkDoneProgressKindEnd,
+	})
+}
+
+// notify sends a $/progress notification carrying the given value
+func (p *indexProgress) notify(ctx context.Context, value interface{}) {
+	err := p.h.conn.Notify(ctx, "$/progress", &lsp.ProgressParams{
+		Token: *lsp.NewProgressToken(indexProgressToken),
+		Value: value,
+	})
+	if err != nil {
+		p.h.logger.Error("Failed to report progress: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+)
+
+// settingsSection is the section of the client settings configuring the server
+const settingsSection = "carrion"
+
+// settings mirrors the carrion section of the client settings, which clients
+// also pass as initialization options. Settings left out are nil, so that
+// they keep their current value.
+type settings struct {
+	InlayHints *struct {
+		ParameterNames *bool `json:"parameterNames"`
+		VariableTypes  *bool `json:"variableTypes"`
+	} `json:"inlayHints"`
+	Diagnostics *struct {
+		// Delay is in milliseconds
+		Delay *int `json:"delay"`
+	} `json:"diagnostics"`
+}
+
+// initializeExtensions holds the initialize params go.lsp.dev/protocol does
+// not decode: the initialization options and the capabilities of later
+// protocol versions
+type initializeExtensions struct {
+	InitializationOptions *settings `json:"initializationOptions"`
+	Capabilities          struct {
+		TextDocument struct {
+			Diagnostic *struct{} `json:"diagnostic"`
+		} `json:"textDocument"`
+		Workspace struct {
+			InlayHint *struct {
+				RefreshSupport bool `json:"refreshSupport"`
+			} `json:"inlayHint"`
+			Diagnostics *struct {
+				RefreshSupport bool `json:"refreshSupport"`
+			} `json:"diagnostics"`
+		} `json:"workspace"`
+	} `json:"capabilities"`
+}
+
+// applySettings updates the server configuration from the client settings,
+// reporting whether the inlay hints to show changed
+func (h *Handler) applySettings(s settings) bool {
+	if s.Diagnostics != nil && s.Diagnostics.Delay != nil {
+		h.diagnosticsDelay = time.Duration(max(*s.Diagnostics.Delay, 0)) * time.Millisecond
+	}
+
+	if s.InlayHints == nil {
+		return false
+	}
+
+	current := h.analyzer.InlayHintSettings()
+	updated := current
+	if s.InlayHints.ParameterNames != nil {
+		updated.ParameterNames = *s.InlayHints.ParameterNames
+	}
+	if s.InlayHints.VariableTypes != nil {
+		updated.VariableTypes = *s.InlayHints.VariableTypes
+	}
+	h.analyzer.SetInlayHintSettings(updated)
+	return updated != current
+}
+
+func (h *Handler) handleWorkspaceDidChangeConfiguration(
+	ctx context.Context,
+	req jsonrpc2.Request,
+) (interface{}, error) {
+	var params struct {
+		Settings json.RawMessage `json:"settings"`
+	}
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return nil, err
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(params.Settings, &sections); err != nil || sections[settingsSection] == nil {
+		h.logger.Debug("Configuration change without %s settings", settingsSection)
+		return nil, nil
+	}
+
+	var s settings
+	if err := json.Unmarshal(sections[settingsSection], &s); err != nil {
+		h.logger.Warn("Invalid %s settings: %v", settingsSection, err)
+		return nil, nil
+	}
+
+	h.logger.Debug("Configuration changed")
+	if h.applySettings(s) && h.inlayHintRefresh {
+		go h.refreshInlayHints(context.WithoutCancel(ctx))
+	}
+
+	return nil, nil
+}
+
+// refreshInlayHints asks the client to request the inlay hints of open
+// documents again
+func (h *Handler) refreshInlayHints(ctx context.Context) {
+	if _, err := h.conn.Call(ctx, "workspace/inlayHint/refresh", nil, nil); err != nil {
+		h.logger.Warn("Failed to refresh inlay hints: %v", err)
+	}
+}
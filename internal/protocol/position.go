@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	lsp "go.lsp.dev/protocol"
+)
+
+// OffsetAt converts an LSP position into a byte offset into text.
+//
+// LSP positions count characters in UTF-16 code units, so characters outside
+// the Basic Multilingual Plane occupy two units. Lines end at "\r\n", "\r" or
+// "\n". Positions past the end of a line clamp to the end of that line, and
+// lines past the end of the text clamp to the end of the text.
+func OffsetAt(text string, pos lsp.Position) int {
+	offset := 0
+	for line := uint32(0); line < pos.Line; line++ {
+		next := strings.IndexAny(text[offset:], "\r\n")
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + lineBreakLen(text, offset+next)
+	}
+
+	units := uint32(0)
+	for offset < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' || r == '\r' {
+			break
+		}
+		units += utf16Len(r)
+		offset += size
+	}
+
+	return offset
+}
+
+// PositionAt converts a byte offset into text into an LSP position. An offset
+// between the two characters of a "\r\n" is at the end of its line.
+func PositionAt(text string, offset int) lsp.Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+
+	var pos lsp.Position
+	for i, r := range text {
+		if i >= offset {
+			break
+		}
+		if r == '\n' || r == '\r' {
+			// The "\n" of a "\r\n" ends the line
+			if lineBreakLen(text, i) == 1 {
+				pos.Line++
+				pos.Character = 0
+			}
+			continue
+		}
+		pos.Character += utf16Len(r)
+	}
+
+	return pos
+}
+
+// lineBreakLen returns the length of the line break at text[i]: 2 for "\r\n",
+// 1 for "\r" or "\n", 0 when there is none
+func lineBreakLen(text string, i int) int {
+	switch {
+	case text[i] == '\r' && i+1 < len(text) && text[i+1] == '\n':
+		return 2
+	case text[i] == '\r' || text[i] == '\n':
+		return 1
+	}
+	return 0
+}
+
+// UTF16Len returns the length of s in UTF-16 code units
+func UTF16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += int(utf16Len(r))
+	}
+	return n
+}
+
+// utf16Len returns the number of UTF-16 code units needed to encode r
+func utf16Len(r rune) uint32 {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
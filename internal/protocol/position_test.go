@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/util"
+)
+
+func TestOffsetAt(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		pos    lsp.Position
+		offset int
+	}{
+		{"start", "ab\ncd", lsp.Position{Line: 0, Character: 0}, 0},
+		{"second line", "ab\ncd", lsp.Position{Line: 1, Character: 1}, 4},
+		{"past end of line", "ab\ncd", lsp.Position{Line: 0, Character: 9}, 2},
+		{"past end of text", "ab\ncd", lsp.Position{Line: 5, Character: 0}, 5},
+		{"surrogate pair", "😀x\n", lsp.Position{Line: 0, Character: 2}, 4},
+		{"crlf second line", "ab\r\ncd\r\nef", lsp.Position{Line: 1, Character: 1}, 5},
+		{"crlf third line", "ab\r\ncd\r\nef", lsp.Position{Line: 2, Character: 0}, 8},
+		{"crlf past end of line", "ab\r\ncd", lsp.Position{Line: 0, Character: 9}, 2},
+		{"cr", "ab\rcd", lsp.Position{Line: 1, Character: 1}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OffsetAt(tt.text, tt.pos); got != tt.offset {
+				t.Errorf("OffsetAt(%q, %v) = %d, want %d", tt.text, tt.pos, got, tt.offset)
+			}
+		})
+	}
+}
+
+func TestPositionAt(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		offset int
+		pos    lsp.Position
+	}{
+		{"start", "ab\ncd", 0, lsp.Position{Line: 0, Character: 0}},
+		{"second line", "ab\ncd", 4, lsp.Position{Line: 1, Character: 1}},
+		{"end of text", "ab\ncd", 99, lsp.Position{Line: 1, Character: 2}},
+		{"surrogate pair", "😀x", 5, lsp.Position{Line: 0, Character: 3}},
+		{"crlf second line", "ab\r\ncd\r\nef", 5, lsp.Position{Line: 1, Character: 1}},
+		{"crlf third line", "ab\r\ncd\r\nef", 8, lsp.Position{Line: 2, Character: 0}},
+		{"within crlf", "ab\r\ncd", 3, lsp.Position{Line: 0, Character: 2}},
+		{"cr", "ab\rcd", 4, lsp.Position{Line: 1, Character: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PositionAt(tt.text, tt.offset); got != tt.pos {
+				t.Errorf("PositionAt(%q, %d) = %v, want %v", tt.text, tt.offset, got, tt.pos)
+			}
+		})
+	}
+}
+
+func TestUpdateDocumentCRLF(t *testing.T) {
+	store := NewDocumentStore(util.NewLogger(util.StderrLogger{}))
+	uri := lsp.DocumentURI("file:///crlf.crl")
+	store.AddDocument(uri, "carrion", "x = 1\r\ny = 2\r\nz = 3\r\n", 1)
+
+	// Replace the 2 of the second line, then append to the third one
+	doc, err := store.UpdateDocument(uri, []TextDocumentContentChangeEvent{
+		{
+			Range: &lsp.Range{
+				Start: lsp.Position{Line: 1, Character: 4},
+				End:   lsp.Position{Line: 1, Character: 5},
+			},
+			Text: "20",
+		},
+		{
+			Range: &lsp.Range{
+				Start: lsp.Position{Line: 2, Character: 5},
+				End:   lsp.Position{Line: 2, Character: 5},
+			},
+			Text: "0",
+		},
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "x = 1\r\ny = 20\r\nz = 30\r\n"
+	if doc.Text != want {
+		t.Errorf("text = %q, want %q", doc.Text, want)
+	}
+}
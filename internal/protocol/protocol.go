@@ -1,36 +1,229 @@
 package protocol
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+
 	lsp "go.lsp.dev/protocol"
 
 	"github.com/carrionlang-lsp/lsp/internal/util"
 )
 
-// CarrionDocument represents a Carrion source file that is being edited
+// ErrDocumentOutOfSync is returned when an update cannot be applied because
+// the server's copy of a document no longer matches the client's
+var ErrDocumentOutOfSync = errors.New("document out of sync")
+
+// CarrionDocument represents a Carrion source file that is being edited.
+// Documents are not modified once stored: updates store a new document, so a
+// document obtained from the store stays consistent while it is edited.
 type CarrionDocument struct {
 	URI        lsp.DocumentURI
 	Text       string
 	Version    int32
 	LanguageID string
+	// OutOfSync is set when an update was rejected. Ranged edits are refused
+	// until a full content change or a reopen brings the document back in sync.
+	OutOfSync bool
+}
+
+// TextDocumentContentChangeEvent describes a change to a text document.
+//
+// Unlike lsp.TextDocumentContentChangeEvent the range is optional, which is
+// how the protocol tells a full content replacement apart from a ranged edit.
+type TextDocumentContentChangeEvent struct {
+	Range       *lsp.Range `json:"range,omitempty"`
+	RangeLength uint32     `json:"rangeLength,omitempty"`
+	Text        string     `json:"text"`
+}
+
+// DidChangeTextDocumentParams are the params of the textDocument/didChange notification
+type DidChangeTextDocumentParams struct {
+	TextDocument   lsp.VersionedTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent    `json:"contentChanges"`
+}
+
+// SemanticTokensOptions are the semantic token capabilities of the server.
+//
+// lsp.SemanticTokensOptions lacks the legend and the requests the server
+// answers, which clients need to request tokens at all.
+type SemanticTokensOptions struct {
+	Legend lsp.SemanticTokensLegend   `json:"legend"`
+	Range  bool                       `json:"range,omitempty"`
+	Full   *SemanticTokensFullOptions `json:"full,omitempty"`
+}
+
+// SemanticTokensFullOptions tells whether the server answers delta requests
+type SemanticTokensFullOptions struct {
+	Delta bool `json:"delta,omitempty"`
+}
+
+// ServerCapabilities extends lsp.ServerCapabilities with the capabilities of
+// protocol versions after the one go.lsp.dev/protocol implements
+type ServerCapabilities struct {
+	lsp.ServerCapabilities
+	InlayHintProvider     bool               `json:"inlayHintProvider,omitempty"`
+	TypeHierarchyProvider bool               `json:"typeHierarchyProvider,omitempty"`
+	DiagnosticProvider    *DiagnosticOptions `json:"diagnosticProvider,omitempty"`
+}
+
+// DiagnosticOptions are the pull diagnostic capabilities of the server
+type DiagnosticOptions struct {
+	Identifier            string `json:"identifier,omitempty"`
+	InterFileDependencies bool   `json:"interFileDependencies"`
+	WorkspaceDiagnostics  bool   `json:"workspaceDiagnostics"`
+}
+
+// InitializeResult is the result of the initialize request, carrying the
+// extended server capabilities
+type InitializeResult struct {
+	Capabilities ServerCapabilities `json:"capabilities"`
+	ServerInfo   *lsp.ServerInfo    `json:"serverInfo,omitempty"`
+}
+
+// InlayHintParams are the params of the textDocument/inlayHint request
+type InlayHintParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+	Range        lsp.Range                  `json:"range"`
 }
 
-// CarrionDocumentStore keeps track of all open documents
+// InlayHintKind tells whether an inlay hint shows a type or a parameter name
+type InlayHintKind uint32
+
+const (
+	InlayHintKindType      InlayHintKind = 1
+	InlayHintKindParameter InlayHintKind = 2
+)
+
+// InlayHint is an annotation shown inline in the source
+type InlayHint struct {
+	Position     lsp.Position  `json:"position"`
+	Label        string        `json:"label"`
+	Kind         InlayHintKind `json:"kind,omitempty"`
+	PaddingLeft  bool          `json:"paddingLeft,omitempty"`
+	PaddingRight bool          `json:"paddingRight,omitempty"`
+}
+
+// TypeHierarchyPrepareParams are the params of the
+// textDocument/prepareTypeHierarchy request
+type TypeHierarchyPrepareParams struct {
+	lsp.TextDocumentPositionParams
+}
+
+// TypeHierarchyItem is a type in a type hierarchy
+type TypeHierarchyItem struct {
+	Name           string          `json:"name"`
+	Kind           lsp.SymbolKind  `json:"kind"`
+	Tags           []lsp.SymbolTag `json:"tags,omitempty"`
+	Detail         string          `json:"detail,omitempty"`
+	URI            lsp.DocumentURI `json:"uri"`
+	Range          lsp.Range       `json:"range"`
+	SelectionRange lsp.Range       `json:"selectionRange"`
+	Data           interface{}     `json:"data,omitempty"`
+}
+
+// TypeHierarchySupertypesParams are the params of the
+// typeHierarchy/supertypes request
+type TypeHierarchySupertypesParams struct {
+	Item TypeHierarchyItem `json:"item"`
+}
+
+// TypeHierarchySubtypesParams are the params of the typeHierarchy/subtypes
+// request
+type TypeHierarchySubtypesParams struct {
+	Item TypeHierarchyItem `json:"item"`
+}
+
+// DocumentDiagnosticParams are the params of the textDocument/diagnostic
+// request
+type DocumentDiagnosticParams struct {
+	TextDocument     lsp.TextDocumentIdentifier `json:"textDocument"`
+	Identifier       string                     `json:"identifier,omitempty"`
+	PreviousResultID string                     `json:"previousResultId,omitempty"`
+}
+
+// DocumentDiagnosticReportKind tells whether a diagnostic report lists the
+// diagnostics of a document or says they did not change
+type DocumentDiagnosticReportKind string
+
+const (
+	DocumentDiagnosticReportKindFull      DocumentDiagnosticReportKind = "full"
+	DocumentDiagnosticReportKindUnchanged DocumentDiagnosticReportKind = "unchanged"
+)
+
+// FullDocumentDiagnosticReport lists the diagnostics of a document
+type FullDocumentDiagnosticReport struct {
+	Kind     DocumentDiagnosticReportKind `json:"kind"`
+	ResultID string                       `json:"resultId,omitempty"`
+	Items    []lsp.Diagnostic             `json:"items"`
+}
+
+// UnchangedDocumentDiagnosticReport says the diagnostics of a document are
+// still those of the previous result
+type UnchangedDocumentDiagnosticReport struct {
+	Kind     DocumentDiagnosticReportKind `json:"kind"`
+	ResultID string                       `json:"resultId"`
+}
+
+// PreviousResultID is the result id of the diagnostics a client holds for a
+// document
+type PreviousResultID struct {
+	URI   lsp.DocumentURI `json:"uri"`
+	Value string          `json:"value"`
+}
+
+// WorkspaceDiagnosticParams are the params of the workspace/diagnostic request
+type WorkspaceDiagnosticParams struct {
+	Identifier        string             `json:"identifier,omitempty"`
+	PreviousResultIDs []PreviousResultID `json:"previousResultIds"`
+}
+
+// WorkspaceFullDocumentDiagnosticReport lists the diagnostics of a workspace
+// document. Version is nil for documents that are not open.
+type WorkspaceFullDocumentDiagnosticReport struct {
+	FullDocumentDiagnosticReport
+	URI     lsp.DocumentURI `json:"uri"`
+	Version *int32          `json:"version"`
+}
+
+// WorkspaceUnchangedDocumentDiagnosticReport says the diagnostics of a
+// workspace document did not change. Version is nil for documents that are
+// not open.
+type WorkspaceUnchangedDocumentDiagnosticReport struct {
+	UnchangedDocumentDiagnosticReport
+	URI     lsp.DocumentURI `json:"uri"`
+	Version *int32          `json:"version"`
+}
+
+// WorkspaceDiagnosticReport is the result of the workspace/diagnostic request.
+// Its items are WorkspaceFullDocumentDiagnosticReport or
+// WorkspaceUnchangedDocumentDiagnosticReport values.
+type WorkspaceDiagnosticReport struct {
+	Items []interface{} `json:"items"`
+}
+
+// CarrionDocumentStore keeps track of all open documents. It is safe for
+// concurrent use.
 type CarrionDocumentStore struct {
-	Documents map[lsp.DocumentURI]*CarrionDocument
+	mu        sync.RWMutex
+	documents map[lsp.DocumentURI]*CarrionDocument
 	Logger    *util.Logger
 }
 
 // NewDocumentStore creates a new document store
 func NewDocumentStore(logger *util.Logger) *CarrionDocumentStore {
 	return &CarrionDocumentStore{
-		Documents: make(map[lsp.DocumentURI]*CarrionDocument),
+		documents: make(map[lsp.DocumentURI]*CarrionDocument),
 		Logger:    logger,
 	}
 }
 
 // GetDocument retrieves a document by URI
 func (s *CarrionDocumentStore) GetDocument(uri lsp.DocumentURI) *CarrionDocument {
-	doc, ok := s.Documents[uri]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.documents[uri]
 	if !ok {
 		return nil
 	}
@@ -50,41 +243,97 @@ func (s *CarrionDocumentStore) AddDocument(
 		Version:    version,
 		LanguageID: languageID,
 	}
-	s.Documents[uri] = doc
+
+	s.mu.Lock()
+	s.documents[uri] = doc
+	s.mu.Unlock()
+
 	s.Logger.Debug("Added document: %s (version: %d)", uri, version)
 	return doc
 }
 
-// UpdateDocument updates a document's content
+// UpdateDocument applies content changes to a document in order.
+//
+// Ranged changes apply to the stored version only, so an update with ranged
+// changes must carry the version following it. Any other version means an
+// earlier update was lost or reordered: the update is rejected and the
+// document is marked out of sync until a full content change arrives.
 func (s *CarrionDocumentStore) UpdateDocument(
 	uri lsp.DocumentURI,
-	changes []lsp.TextDocumentContentChangeEvent,
+	changes []TextDocumentContentChangeEvent,
 	version int32,
-) *CarrionDocument {
-	doc := s.GetDocument(uri)
-	if doc == nil {
+) (*CarrionDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[uri]
+	if !ok {
 		s.Logger.Error("Cannot update non-existent document: %s", uri)
-		return nil
+		return nil, fmt.Errorf("document not found: %s", uri)
 	}
 
 	// Update the document based on the changes
 	if len(changes) == 0 {
 		s.Logger.Warn("Document update with no changes: %s", uri)
-		return doc
+		return doc, nil
 	}
 
-	// Handle full document update
-	// Note: We're only supporting full content updates for now
-	doc.Text = changes[0].Text
-	doc.Version = version
-	s.Logger.Debug("Full update of document: %s (version: %d)", uri, version)
-	return doc
+	resync := changes[0].Range == nil
+	if !resync {
+		if doc.OutOfSync {
+			return nil, fmt.Errorf("%w: %s awaits a full content change", ErrDocumentOutOfSync, uri)
+		}
+		if version != doc.Version+1 {
+			outOfSync := *doc
+			outOfSync.OutOfSync = true
+			s.documents[uri] = &outOfSync
+			return nil, fmt.Errorf(
+				"%w: %s received version %d after version %d",
+				ErrDocumentOutOfSync,
+				uri,
+				version,
+				doc.Version,
+			)
+		}
+	}
+
+	text := doc.Text
+	for _, change := range changes {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+
+		start := OffsetAt(text, change.Range.Start)
+		end := OffsetAt(text, change.Range.End)
+		if end < start {
+			start, end = end, start
+		}
+		text = text[:start] + change.Text + text[end:]
+	}
+
+	updated := &CarrionDocument{
+		URI:        uri,
+		Text:       text,
+		Version:    version,
+		LanguageID: doc.LanguageID,
+	}
+	s.documents[uri] = updated
+	if resync {
+		s.Logger.Debug("Full update of document: %s (version: %d)", uri, version)
+	} else {
+		s.Logger.Debug("Incremental update of document: %s (version: %d, changes: %d)", uri, version, len(changes))
+	}
+	return updated, nil
 }
 
 // RemoveDocument removes a document from the store
 func (s *CarrionDocumentStore) RemoveDocument(uri lsp.DocumentURI) {
-	if _, ok := s.Documents[uri]; ok {
-		delete(s.Documents, uri)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.documents[uri]; ok {
+		delete(s.documents, uri)
 		s.Logger.Debug("Removed document: %s", uri)
 	}
 }
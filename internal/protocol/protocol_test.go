@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+
+	lsp "go.lsp.dev/protocol"
+
+	"github.com/carrionlang-lsp/lsp/internal/util"
+)
+
+func TestUpdateDocumentVersions(t *testing.T) {
+	store := NewDocumentStore(util.NewLogger(util.StderrLogger{}))
+	uri := lsp.DocumentURI("file:///versions.crl")
+	store.AddDocument(uri, "carrion", "x = 1\n", 1)
+
+	// insert appends a digit to the number of the first line
+	insert := func(version int32) error {
+		_, err := store.UpdateDocument(uri, []TextDocumentContentChangeEvent{{
+			Range: &lsp.Range{
+				Start: lsp.Position{Line: 0, Character: 5},
+				End:   lsp.Position{Line: 0, Character: 5},
+			},
+			Text: "0",
+		}}, version)
+		return err
+	}
+
+	if err := insert(2); err != nil {
+		t.Fatalf("consecutive version: %v", err)
+	}
+	if err := insert(4); !errors.Is(err, ErrDocumentOutOfSync) {
+		t.Fatalf("version gap: error = %v, want %v", err, ErrDocumentOutOfSync)
+	}
+	if err := insert(5); !errors.Is(err, ErrDocumentOutOfSync) {
+		t.Errorf("ranged change out of sync: error = %v, want %v", err, ErrDocumentOutOfSync)
+	}
+
+	// A full content change brings the document back in sync
+	doc, err := store.UpdateDocument(uri, []TextDocumentContentChangeEvent{{Text: "y = 2\n"}}, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.OutOfSync || doc.Text != "y = 2\n" {
+		t.Errorf("after a full change, document = %+v", doc)
+	}
+	if err := insert(7); err != nil {
+		t.Errorf("after a resync: %v", err)
+	}
+	if got := store.GetDocument(uri).Text; got != "y = 20\n" {
+		t.Errorf("text = %q, want %q", got, "y = 20\n")
+	}
+}
@@ -0,0 +1,161 @@
+package symbols
+
+import (
+	"strings"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+)
+
+// Import represents an import statement of a file. As when the program
+// runs, an import with an alias binds the alias to the whole imported file,
+// and one without an alias makes the Grimoires of the file visible.
+type Import struct {
+	Path  string
+	Alias string
+	// URI is the file the import path resolved to, "" when it could not be
+	// resolved
+	URI string
+	// Line and Column locate the import path in the importing file
+	Line   int
+	Column int
+}
+
+// BoundName returns the name an import introduces into the importing file,
+// "" when it makes the Grimoires of the imported file visible instead
+func (imp *Import) BoundName() string {
+	return imp.Alias
+}
+
+// processImportStatement records an import of the current file, whose source
+// lines are given, and defines the alias it is bound to, if any
+func (st *SymbolTable) processImportStatement(node *ast.ImportStatement, scope *Scope, lines []string) {
+	if node.FilePath == nil {
+		return
+	}
+
+	pos := extractPositionFromToken(node.Token)
+	imp := &Import{
+		Path:   node.FilePath.Value,
+		Line:   pos.Line,
+		Column: importPathColumn(lines, pos.Line, pos.Column+len(node.Token.Literal)),
+	}
+	if node.Alias != nil {
+		imp.Alias = node.Alias.Value
+	}
+	st.Imports[st.CurrentURI] = append(st.Imports[st.CurrentURI], imp)
+
+	if node.Alias == nil {
+		return
+	}
+
+	aliasPos := extractPositionFromToken(node.Alias.Token)
+	aliasSymbol := &Symbol{
+		Name:             imp.Alias,
+		Type:             "import",
+		ValueType:        imp.Path,
+		DefinitionURI:    st.CurrentURI,
+		DefinitionLine:   aliasPos.Line,
+		DefinitionColumn: aliasPos.Column,
+	}
+	scope.Symbols[imp.Alias] = aliasSymbol
+	st.addDeclaration(node.Alias, scope, aliasSymbol)
+}
+
+// importPathColumn returns the column of the opening quote of the path of an
+// import whose keyword ends at the given column. The lexer gives strings no
+// position, so the quote is looked up in the source line, and assumed to
+// follow the keyword after a single space when the line is unknown.
+func importPathColumn(lines []string, line, column int) int {
+	if line < 0 || line >= len(lines) || column > len(lines[line]) {
+		return column + 1
+	}
+	if quote := strings.IndexAny(lines[line][column:], "\"'`"); quote >= 0 {
+		return column + quote
+	}
+	return column + 1
+}
+
+// ImportFor returns the import that binds the given name in a file, if any
+func (st *SymbolTable) ImportFor(name string, uri string) *Import {
+	for _, imp := range st.Imports[uri] {
+		if imp.BoundName() == name {
+			return imp
+		}
+	}
+	return nil
+}
+
+// ImportedSymbol finds a Grimoire made visible in a file by its imports
+// without an alias
+func (st *SymbolTable) ImportedSymbol(name string, uri string) *Symbol {
+	for _, imp := range st.Imports[uri] {
+		if imp.Alias != "" {
+			continue
+		}
+		if symbol := st.ModuleMember(imp, name); symbol != nil && symbol.Type == "Grimoire" {
+			return symbol
+		}
+	}
+	return nil
+}
+
+// ModuleMember returns a name the file an import resolved to defines at top
+// level or imports, as reachable through an alias of the import
+func (st *SymbolTable) ModuleMember(imp *Import, name string) *Symbol {
+	for _, symbol := range st.ModuleSymbols(imp) {
+		if symbol.Name == name {
+			return symbol
+		}
+	}
+	return nil
+}
+
+// ModuleSymbols returns the names the file an import resolved to defines at
+// top level or imports, which an alias of the import gives access to
+func (st *SymbolTable) ModuleSymbols(imp *Import) []*Symbol {
+	return st.moduleSymbols(imp.URI, make(map[string]bool))
+}
+
+// moduleSymbols returns the names defined at top level in a file and the
+// Grimoires its imports without an alias make visible there. Files already
+// seen are skipped, so that circular imports terminate.
+func (st *SymbolTable) moduleSymbols(uri string, seen map[string]bool) []*Symbol {
+	fileScope, ok := st.FileScopes[uri]
+	if uri == "" || !ok || seen[uri] {
+		return nil
+	}
+	seen[uri] = true
+
+	symbols := make([]*Symbol, 0, len(fileScope.Symbols))
+	for _, symbol := range fileScope.Symbols {
+		symbols = append(symbols, symbol)
+	}
+	for _, imp := range st.Imports[uri] {
+		if imp.Alias != "" {
+			continue
+		}
+		for _, symbol := range st.moduleSymbols(imp.URI, seen) {
+			if symbol.Type == "Grimoire" {
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols
+}
+
+// ImportedSymbols returns the Grimoires a file's imports without an alias make
+// visible
+func (st *SymbolTable) ImportedSymbols(uri string) []*Symbol {
+	symbols := make([]*Symbol, 0)
+	for _, imp := range st.Imports[uri] {
+		if imp.Alias != "" {
+			continue
+		}
+		for _, symbol := range st.ModuleSymbols(imp) {
+			if symbol.Type == "Grimoire" {
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols
+}
@@ -0,0 +1,21 @@
+package symbols
+
+import "testing"
+
+func TestImportPathColumn(t *testing.T) {
+	const uri = "file:///imports.crl"
+	st := buildTable(t, uri, "import \"a\"\n"+
+		"import   \"b\"\n"+
+		"import\t'c' as c\n")
+
+	want := map[string]int{"a": 7, "b": 9, "c": 7}
+	imports := st.Imports[uri]
+	if len(imports) != len(want) {
+		t.Fatalf("imports = %v, want %d", imports, len(want))
+	}
+	for _, imp := range imports {
+		if imp.Column != want[imp.Path] {
+			t.Errorf("column of %q = %d, want %d", imp.Path, imp.Column, want[imp.Path])
+		}
+	}
+}
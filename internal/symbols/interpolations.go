@@ -0,0 +1,235 @@
+package symbols
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	"github.com/javanhut/TheCarrionLanguage/src/lexer"
+	"github.com/javanhut/TheCarrionLanguage/src/parser"
+)
+
+// interpolation is an expression embedded in an f-string or an interpolated
+// string, with the 0-based position where its text starts
+type interpolation struct {
+	line   int
+	column int
+	text   string
+}
+
+// collectInterpolationReferences records the names used by the expressions
+// embedded in the strings of a file. The parser gives those names positions
+// relative to the expression rather than the file, so the expressions are
+// found and parsed again from the source text.
+func (st *SymbolTable) collectInterpolationReferences(fileScope *Scope, text string) {
+	for _, interp := range findInterpolations(text) {
+		expr := parseInterpolation(interp.text)
+		if expr == nil {
+			continue
+		}
+
+		first := len(st.References[st.CurrentURI])
+		st.collectExpressionReferences(expr, innermostScope(fileScope, interp.line))
+		for _, ref := range st.References[st.CurrentURI][first:] {
+			if ref.Line == 0 {
+				ref.Column += interp.column
+			}
+			ref.Line += interp.line
+		}
+	}
+}
+
+// parseInterpolation parses the text of an embedded expression the way the
+// parser does, returning nil when it is not a single valid expression
+func parseInterpolation(text string) ast.Expression {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 || len(program.Statements) != 1 {
+		return nil
+	}
+	if stmt, ok := program.Statements[0].(*ast.ExpressionStatement); ok {
+		return stmt.Expression
+	}
+	return nil
+}
+
+// innermostScope returns the innermost Grimoire, spell or method scope of a
+// file that contains the given line
+func innermostScope(scope *Scope, line int) *Scope {
+	contains := func(s *Scope) bool {
+		return s != nil && s.URI == scope.URI && line >= s.StartLine && line <= s.EndLine
+	}
+
+	for _, symbol := range scope.Symbols {
+		if !contains(symbol.Scope) || symbol.Scope == scope {
+			continue
+		}
+		if Grimoire := symbol.Scope.Grimoire; Grimoire != nil {
+			for _, method := range Grimoire.Methods {
+				if contains(method.Scope) {
+					return innermostScope(method.Scope, line)
+				}
+			}
+		}
+		return innermostScope(symbol.Scope, line)
+	}
+	return scope
+}
+
+// stringState is what the scan of findInterpolations is inside of when a
+// line ends
+type stringState struct {
+	quote        byte
+	triple       bool
+	interpolated byte // 'f' or 'i' for f-strings and interpolated strings
+	comment      string
+}
+
+// findInterpolations returns the expressions embedded in the f-strings and
+// interpolated strings of a text, in order. Comments and other strings are
+// skipped the way the lexer skips them.
+func findInterpolations(text string) []interpolation {
+	interps := make([]interpolation, 0)
+	var state stringState
+
+	for lineNum, line := range strings.Split(text, "\n") {
+		i := 0
+		for i < len(line) {
+			switch {
+			case state.comment != "":
+				end := strings.Index(line[i:], state.comment)
+				if end < 0 {
+					i = len(line)
+					continue
+				}
+				i += end + len(state.comment)
+				state.comment = ""
+
+			case state.quote != 0:
+				i = scanString(line, i, lineNum, &state, &interps)
+
+			case line[i] == '#':
+				i = len(line)
+
+			case strings.HasPrefix(line[i:], "/*"):
+				state.comment = "*/"
+				i += 2
+
+			case strings.HasPrefix(line[i:], "```"):
+				state.comment = "```"
+				i += 3
+
+			case (line[i] == 'f' || line[i] == 'i') && i+1 < len(line) && isQuote(line[i+1]) &&
+				(i == 0 || !isIdentifierByte(line[i-1])):
+				state.interpolated = line[i]
+				i = openString(line, i+1, &state)
+
+			case isQuote(line[i]):
+				state.interpolated = 0
+				i = openString(line, i, &state)
+
+			default:
+				i++
+			}
+		}
+
+		// Only triple-quoted strings and block comments span lines
+		if !state.triple {
+			state.quote = 0
+		}
+	}
+	return interps
+}
+
+// openString enters the string whose opening quote is at i and returns the
+// index of its first character
+func openString(line string, i int, state *stringState) int {
+	state.quote = line[i]
+	state.triple = strings.HasPrefix(line[i:], strings.Repeat(string(line[i]), 3))
+	if state.triple {
+		return i + 3
+	}
+	return i + 1
+}
+
+// scanString scans the string the state is inside of from i, recording its
+// embedded expressions, and returns the index where the scan stopped
+func scanString(line string, i, lineNum int, state *stringState, interps *[]interpolation) int {
+	for i < len(line) {
+		ch := line[i]
+		switch {
+		case ch == '\\':
+			i += 2
+			continue
+
+		case state.triple && strings.HasPrefix(line[i:], strings.Repeat(string(state.quote), 3)):
+			state.quote, state.triple = 0, false
+			return i + 3
+
+		case !state.triple && ch == state.quote:
+			state.quote = 0
+			return i + 1
+
+		case state.interpolated == 'f' && ch == '{':
+			// The parser ends the expression at the first closing brace
+			end := strings.IndexByte(line[i+1:], '}')
+			if end < 0 {
+				return len(line)
+			}
+			*interps = append(*interps, interpolation{lineNum, i + 1, line[i+1 : i+1+end]})
+			i += end + 2
+			continue
+
+		case state.interpolated == 'i' && ch == '$' && i+1 < len(line) && line[i+1] == '{':
+			i = scanInterpolatedExpression(line, i+2, lineNum, interps)
+			continue
+		}
+		i++
+	}
+	return i
+}
+
+// scanInterpolatedExpression records the expression of an interpolated
+// string starting at i, up to its format spec or its closing brace, and
+// returns the index following the closing brace
+func scanInterpolatedExpression(line string, i, lineNum int, interps *[]interpolation) int {
+	depth := 1
+	end := -1
+	j := i
+	for ; j < len(line); j++ {
+		switch line[j] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ':':
+			// As in the parser, the last colon starts the format spec
+			if depth == 1 {
+				end = j
+			}
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if depth > 0 {
+		return len(line)
+	}
+
+	if end < 0 {
+		end = j
+	}
+	*interps = append(*interps, interpolation{lineNum, i, line[i:end]})
+	return j + 1
+}
+
+// isQuote reports whether a byte opens a string
+func isQuote(ch byte) bool {
+	return ch == '"' || ch == '\''
+}
+
+// isIdentifierByte reports whether a byte may be part of an identifier, as
+// the lexer decides it
+func isIdentifierByte(ch byte) bool {
+	return unicode.IsLetter(rune(ch)) || unicode.IsDigit(rune(ch)) || ch == '_'
+}
@@ -0,0 +1,76 @@
+package symbols
+
+import (
+	"testing"
+
+	"github.com/javanhut/TheCarrionLanguage/src/lexer"
+	"github.com/javanhut/TheCarrionLanguage/src/parser"
+)
+
+// buildTable builds the symbol table of a single file from its source
+func buildTable(t *testing.T, uri, text string) *SymbolTable {
+	t.Helper()
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+
+	st := NewSymbolTable()
+	st.BuildFromAST(program, uri, text)
+	return st
+}
+
+func TestInterpolationReferences(t *testing.T) {
+	const uri = "file:///interp.crl"
+	text := "old = 1\n" +
+		"print(f\"value {old} and {old + 1}\")\n" +
+		"print(i\"${old:>5} \\\" {old}\")\n" +
+		"# f\"{old}\"\n" +
+		"print(\"{old}\")\n"
+	st := buildTable(t, uri, text)
+
+	symbol := st.FileScopes[uri].Symbols["old"]
+	if symbol == nil {
+		t.Fatal("old is not defined")
+	}
+
+	want := map[[2]int]bool{
+		{0, 0}:  true,
+		{1, 15}: true,
+		{1, 25}: true,
+		{2, 10}: true,
+	}
+	refs := st.FindReferences(symbol, true)
+	for _, ref := range refs {
+		if !want[[2]int{ref.Line, ref.Column}] {
+			t.Errorf("unexpected reference at %d:%d", ref.Line, ref.Column)
+		}
+		delete(want, [2]int{ref.Line, ref.Column})
+	}
+	for pos := range want {
+		t.Errorf("missing reference at %d:%d", pos[0], pos[1])
+	}
+}
+
+func TestInterpolationReferencesInMethods(t *testing.T) {
+	const uri = "file:///method.crl"
+	text := "grim Greeter:\n" +
+		"    spell greet(name: str):\n" +
+		"        greeting = \"hello\"\n" +
+		"        return f\"{greeting} {self.title}\"\n"
+	st := buildTable(t, uri, text)
+
+	ref := st.ReferenceAt(uri, 3, 19)
+	if ref == nil || ref.Name != "greeting" {
+		t.Fatalf("ReferenceAt(3, 19) = %v, want greeting", ref)
+	}
+	if ref.Symbol == nil || ref.Symbol.Type != "variable" {
+		t.Errorf("greeting resolved to %v, want the local variable", ref.Symbol)
+	}
+
+	member := st.ReferenceAt(uri, 3, 35)
+	if member == nil || member.Name != "title" || !member.IsMember || member.Receiver != "Greeter" {
+		t.Errorf("ReferenceAt(3, 35) = %+v, want the title member of Greeter", member)
+	}
+}
@@ -0,0 +1,205 @@
+package symbols
+
+import (
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	"github.com/javanhut/TheCarrionLanguage/src/token"
+)
+
+// LastLine returns the 0-based line of the last token belonging to a node,
+// or -1 when the node carries no position information
+func LastLine(node ast.Node) int {
+	last := -1
+	extend := func(line int) {
+		if line > last {
+			last = line
+		}
+	}
+	extendToken := func(tok token.Token) {
+		if tok.Line > 0 {
+			extend(tok.Line - 1)
+		}
+	}
+
+	switch n := node.(type) {
+	case nil:
+	case *ast.Program:
+		extend(lastStatementLine(n.Statements))
+	case *ast.BlockStatement:
+		if n != nil {
+			extendToken(n.Token)
+			extend(lastStatementLine(n.Statements))
+		}
+	case *ast.GrimoireDefinition:
+		extendToken(n.Token)
+		extend(LastLine(n.Name))
+		if n.DocString != nil {
+			extend(LastLine(n.DocString))
+		}
+		if n.InitMethod != nil {
+			extend(LastLine(n.InitMethod))
+		}
+		for _, method := range n.Methods {
+			extend(LastLine(method))
+		}
+	case *ast.FunctionDefinition:
+		extendToken(n.Token)
+		extend(LastLine(n.Name))
+		for _, param := range n.Parameters {
+			extend(LastLine(param))
+		}
+		if n.DocString != nil {
+			extend(LastLine(n.DocString))
+		}
+		if n.Body != nil {
+			extend(LastLine(n.Body))
+		}
+	case *ast.AssignStatement:
+		extendToken(n.Token)
+		extend(LastLine(n.Name))
+		extend(LastLine(n.Value))
+	case *ast.ExpressionStatement:
+		extendToken(n.Token)
+		extend(LastLine(n.Expression))
+	case *ast.ReturnStatement:
+		extendToken(n.Token)
+		extend(LastLine(n.ReturnValue))
+	case *ast.RaiseStatement:
+		extendToken(n.Token)
+		extend(LastLine(n.Error))
+	case *ast.ImportStatement:
+		extendToken(n.Token)
+		if n.FilePath != nil {
+			extend(LastLine(n.FilePath))
+		}
+		if n.ClassName != nil {
+			extend(LastLine(n.ClassName))
+		}
+		if n.Alias != nil {
+			extend(LastLine(n.Alias))
+		}
+	case *ast.IfStatement:
+		extendToken(n.Token)
+		extend(LastLine(n.Condition))
+		if n.Consequence != nil {
+			extend(LastLine(n.Consequence))
+		}
+		for _, branch := range n.OtherwiseBranches {
+			extendToken(branch.Token)
+			extend(LastLine(branch.Condition))
+			if branch.Consequence != nil {
+				extend(LastLine(branch.Consequence))
+			}
+		}
+		if n.Alternative != nil {
+			extend(LastLine(n.Alternative))
+		}
+	case *ast.ForStatement:
+		extendToken(n.Token)
+		extend(LastLine(n.Iterable))
+		if n.Body != nil {
+			extend(LastLine(n.Body))
+		}
+		if n.Alternative != nil {
+			extend(LastLine(n.Alternative))
+		}
+	case *ast.WhileStatement:
+		extendToken(n.Token)
+		extend(LastLine(n.Condition))
+		if n.Body != nil {
+			extend(LastLine(n.Body))
+		}
+	case *ast.MatchStatement:
+		extendToken(n.Token)
+		extend(LastLine(n.MatchValue))
+		for _, c := range n.Cases {
+			extend(LastLine(c))
+		}
+		if n.Default != nil {
+			extend(LastLine(n.Default))
+		}
+	case *ast.CaseClause:
+		extendToken(n.Token)
+		extend(LastLine(n.Condition))
+		if n.Body != nil {
+			extend(LastLine(n.Body))
+		}
+	case *ast.AttemptStatement:
+		extendToken(n.Token)
+		if n.TryBlock != nil {
+			extend(LastLine(n.TryBlock))
+		}
+		for _, ensnare := range n.EnsnareClauses {
+			extendToken(ensnare.Token)
+			if ensnare.Consequence != nil {
+				extend(LastLine(ensnare.Consequence))
+			}
+		}
+		if n.ResolveBlock != nil {
+			extend(LastLine(n.ResolveBlock))
+		}
+	case *ast.Identifier:
+		if n != nil {
+			extendToken(n.Token)
+		}
+	case *ast.StringLiteral:
+		if n != nil {
+			extendToken(n.Token)
+		}
+	case *ast.Parameter:
+		extend(LastLine(n.Name))
+		extend(LastLine(n.TypeHint))
+		extend(LastLine(n.DefaultValue))
+	case *ast.PrefixExpression:
+		extendToken(n.Token)
+		extend(LastLine(n.Right))
+	case *ast.InfixExpression:
+		extendToken(n.Token)
+		extend(LastLine(n.Left))
+		extend(LastLine(n.Right))
+	case *ast.CallExpression:
+		extendToken(n.Token)
+		extend(LastLine(n.Function))
+		for _, arg := range n.Arguments {
+			extend(LastLine(arg))
+		}
+	case *ast.DotExpression:
+		extendToken(n.Token)
+		extend(LastLine(n.Left))
+		if n.Right != nil {
+			extend(LastLine(n.Right))
+		}
+	case *ast.IndexExpression:
+		extendToken(n.Token)
+		extend(LastLine(n.Left))
+		extend(LastLine(n.Index))
+	case *ast.ArrayLiteral:
+		extendToken(n.Token)
+		for _, elem := range n.Elements {
+			extend(LastLine(elem))
+		}
+	case *ast.TupleLiteral:
+		extendToken(n.Token)
+		for _, elem := range n.Elements {
+			extend(LastLine(elem))
+		}
+	case *ast.HashLiteral:
+		extendToken(n.Token)
+		for key, value := range n.Pairs {
+			extend(LastLine(key))
+			extend(LastLine(value))
+		}
+	}
+
+	return last
+}
+
+// lastStatementLine returns the last line covered by a list of statements
+func lastStatementLine(stmts []ast.Statement) int {
+	last := -1
+	for _, stmt := range stmts {
+		if line := LastLine(stmt); line > last {
+			last = line
+		}
+	}
+	return last
+}
@@ -0,0 +1,409 @@
+package symbols
+
+import (
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+)
+
+// Reference represents a single occurrence of a name in the code
+type Reference struct {
+	Name   string
+	URI    string
+	Line   int
+	Column int
+	// Symbol is the definition the name resolved to, nil when it could not be
+	// resolved within the file (e.g. a spell defined in another file)
+	Symbol *Symbol
+	Scope  *Scope
+	// Receiver is the Grimoire a member access resolved against, "" when the
+	// type of the accessed object is unknown
+	Receiver      string
+	IsMember      bool
+	IsWrite       bool
+	IsDeclaration bool
+	// IsStatic is set for members accessed through the Grimoire itself
+	// rather than an instance of it
+	IsStatic bool
+
+	// receiverName is the identifier left of the dot in a member access
+	receiverName string
+}
+
+// Contains reports whether the given 0-based position falls on the reference
+func (r *Reference) Contains(line, column int) bool {
+	return r.Line == line && column >= r.Column && column <= r.Column+len(r.Name)
+}
+
+// addReference records an occurrence of an identifier in the given scope
+func (st *SymbolTable) addReference(ident *ast.Identifier, scope *Scope) *Reference {
+	if ident == nil || ident.Value == "" {
+		return nil
+	}
+
+	pos := extractPositionFromToken(ident.Token)
+	ref := &Reference{
+		Name:   ident.Value,
+		URI:    st.CurrentURI,
+		Line:   pos.Line,
+		Column: pos.Column,
+		Scope:  scope,
+	}
+	st.References[st.CurrentURI] = append(st.References[st.CurrentURI], ref)
+	return ref
+}
+
+// addDeclaration records the name of a symbol at its definition site
+func (st *SymbolTable) addDeclaration(ident *ast.Identifier, scope *Scope, symbol *Symbol) {
+	if ref := st.addReference(ident, scope); ref != nil {
+		ref.Symbol = symbol
+		ref.IsDeclaration = true
+		if symbol.Declaration == nil {
+			symbol.Declaration = ref
+		}
+		ref.IsWrite = true
+		ref.IsMember = symbol.Type == "method" || symbol.Type == "field"
+		if ref.IsMember {
+			ref.Receiver = symbol.GrimoireName
+		}
+	}
+}
+
+// addMemberReference records the member name of a dot expression
+func (st *SymbolTable) addMemberReference(node *ast.DotExpression, scope *Scope) *Reference {
+	ref := st.addReference(node.Right, scope)
+	if ref == nil {
+		return nil
+	}
+
+	ref.IsMember = true
+	if receiver, ok := node.Left.(*ast.Identifier); ok {
+		ref.receiverName = receiver.Value
+	}
+	return ref
+}
+
+// collectExpressionReferences records every identifier used by an expression.
+// Names embedded in interpolated strings are recorded by
+// collectInterpolationReferences instead, as they carry no file position.
+func (st *SymbolTable) collectExpressionReferences(expr ast.Expression, scope *Scope) {
+	switch node := expr.(type) {
+	case *ast.Identifier:
+		st.addReference(node, scope)
+	case *ast.PrefixExpression:
+		st.collectExpressionReferences(node.Right, scope)
+	case *ast.PostfixExpression:
+		// Increments write the variable but read it first, so they are
+		// recorded as reads
+		st.collectExpressionReferences(node.Left, scope)
+	case *ast.InfixExpression:
+		st.collectExpressionReferences(node.Left, scope)
+		st.collectExpressionReferences(node.Right, scope)
+	case *ast.CallExpression:
+		st.collectExpressionReferences(node.Function, scope)
+		for _, arg := range node.Arguments {
+			st.collectExpressionReferences(arg, scope)
+		}
+	case *ast.DotExpression:
+		st.collectExpressionReferences(node.Left, scope)
+		st.addMemberReference(node, scope)
+	case *ast.IndexExpression:
+		st.collectExpressionReferences(node.Left, scope)
+		st.collectExpressionReferences(node.Index, scope)
+	case *ast.ArrayLiteral:
+		for _, elem := range node.Elements {
+			st.collectExpressionReferences(elem, scope)
+		}
+	case *ast.TupleLiteral:
+		for _, elem := range node.Elements {
+			st.collectExpressionReferences(elem, scope)
+		}
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			st.collectExpressionReferences(key, scope)
+			st.collectExpressionReferences(value, scope)
+		}
+	case nil, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean, *ast.NoneLiteral,
+		*ast.FStringLiteral, *ast.StringInterpolation:
+	default:
+		// Such as the body of a lambda, which may read any enclosing variable
+		scope.markUnknownReads()
+	}
+}
+
+// resolveReferences binds the references recorded for a file to their
+// definitions once every symbol in the file is known
+func (st *SymbolTable) resolveReferences(uri string) {
+	for _, ref := range st.References[uri] {
+		if ref.IsDeclaration {
+			continue
+		}
+
+		if ref.IsMember {
+			ref.Receiver = st.resolveReceiver(ref.receiverName, ref.Scope)
+			ref.IsStatic = st.isGrimoireName(ref.receiverName, ref.Scope)
+			if Grimoire := st.Grimoires[ref.Receiver]; Grimoire != nil {
+				ref.Symbol = st.LookupMember(Grimoire, ref.Name)
+			}
+			continue
+		}
+
+		ref.Symbol = ref.Scope.Resolve(ref.Name)
+		if ref.Symbol != nil {
+			ref.Symbol.References = append(ref.Symbol.References, ref)
+		}
+	}
+}
+
+// resolveReceiver returns the name of the Grimoire a member access is made on
+func (st *SymbolTable) resolveReceiver(name string, scope *Scope) string {
+	switch name {
+	case "":
+		return ""
+	case "self":
+		if Grimoire := scope.EnclosingGrimoire(); Grimoire != nil {
+			return Grimoire.Name
+		}
+		return ""
+	case "super":
+		if Grimoire := scope.EnclosingGrimoire(); Grimoire != nil {
+			return Grimoire.ParentName
+		}
+		return ""
+	}
+
+	if symbol := scope.Resolve(name); symbol != nil {
+		switch symbol.Type {
+		case "instance":
+			return symbol.GrimoireName
+		case "Grimoire":
+			return symbol.Name
+		}
+		return ""
+	}
+
+	if _, ok := st.Grimoires[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// isGrimoireName reports whether a name refers to a Grimoire itself
+func (st *SymbolTable) isGrimoireName(name string, scope *Scope) bool {
+	if name == "" || name == "self" || name == "super" {
+		return false
+	}
+	if symbol := scope.Resolve(name); symbol != nil {
+		return symbol.Type == "Grimoire"
+	}
+	_, ok := st.Grimoires[name]
+	return ok
+}
+
+// FindMember returns the method or field of the Grimoire with the given name
+func (g *GrimoireSymbol) FindMember(name string) *Symbol {
+	for _, method := range g.Methods {
+		if method.Name == name {
+			return method
+		}
+	}
+	for _, field := range g.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// ParentOf returns the Grimoire a Grimoire inherits from, as seen from the
+// file defining it, or nil when it has no known parent
+func (st *SymbolTable) ParentOf(Grimoire *GrimoireSymbol) *GrimoireSymbol {
+	if Grimoire == nil || Grimoire.ParentName == "" {
+		return nil
+	}
+
+	parent := st.LookupGlobalSymbol(Grimoire.ParentName, Grimoire.DefinitionURI)
+	if parent != nil && parent.Type == "Grimoire" && parent.Scope != nil && parent.Scope.Grimoire != nil {
+		return parent.Scope.Grimoire
+	}
+	return st.Grimoires[Grimoire.ParentName]
+}
+
+// InheritanceChain returns a Grimoire followed by its ancestors, nearest
+// first. The chain stops before a Grimoire seen already, so that cyclic
+// inheritance does not loop.
+func (st *SymbolTable) InheritanceChain(Grimoire *GrimoireSymbol) []*GrimoireSymbol {
+	chain := make([]*GrimoireSymbol, 0)
+	seen := make(map[string]bool)
+	for g := Grimoire; g != nil && !seen[g.Name]; g = st.ParentOf(g) {
+		seen[g.Name] = true
+		chain = append(chain, g)
+	}
+	return chain
+}
+
+// LookupMember returns the method or field a Grimoire defines or inherits
+// under the given name, from the nearest Grimoire of its inheritance chain
+func (st *SymbolTable) LookupMember(Grimoire *GrimoireSymbol, name string) *Symbol {
+	for _, g := range st.InheritanceChain(Grimoire) {
+		if member := g.FindMember(name); member != nil {
+			return member
+		}
+	}
+	return nil
+}
+
+// Members returns the methods and fields a Grimoire defines or inherits.
+// Members overridden along the inheritance chain are listed once, from the
+// Grimoire nearest to the given one.
+func (st *SymbolTable) Members(Grimoire *GrimoireSymbol) []*Symbol {
+	members := make([]*Symbol, 0)
+	seen := make(map[string]bool)
+	add := func(member *Symbol) {
+		if !seen[member.Name] {
+			seen[member.Name] = true
+			members = append(members, member)
+		}
+	}
+
+	for _, g := range st.InheritanceChain(Grimoire) {
+		for _, method := range g.Methods {
+			add(method)
+		}
+		for _, field := range g.Fields {
+			add(field)
+		}
+	}
+	return members
+}
+
+// memberOwner returns the name of the Grimoire defining the member a
+// receiver Grimoire resolves a name to, the receiver itself when the member
+// is unknown
+func (st *SymbolTable) memberOwner(receiver, name string) string {
+	if Grimoire := st.Grimoires[receiver]; Grimoire != nil {
+		if member := st.LookupMember(Grimoire, name); member != nil {
+			return member.GrimoireName
+		}
+	}
+	return receiver
+}
+
+// Resolve finds the symbol a name refers to by walking up the scope chain
+func (s *Scope) Resolve(name string) *Symbol {
+	for scope := s; scope != nil; scope = scope.Parent {
+		// Grimoire scopes hold fields, which are only reachable through self
+		if scope.Grimoire != nil {
+			continue
+		}
+		if symbol, ok := scope.Symbols[name]; ok {
+			return symbol
+		}
+	}
+	return nil
+}
+
+// EnclosingGrimoire returns the Grimoire whose body contains the scope, if any
+func (s *Scope) EnclosingGrimoire() *GrimoireSymbol {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if scope.Grimoire != nil {
+			return scope.Grimoire
+		}
+	}
+	return nil
+}
+
+// ReferenceAt returns the reference at the given 0-based position, if any
+func (st *SymbolTable) ReferenceAt(uri string, line, column int) *Reference {
+	for _, ref := range st.References[uri] {
+		if ref.Contains(line, column) {
+			return ref
+		}
+	}
+	return nil
+}
+
+// SymbolForReference returns the definition a reference points to, looking
+// across files for names that could not be resolved locally
+func (st *SymbolTable) SymbolForReference(ref *Reference) *Symbol {
+	if ref.Symbol != nil {
+		return ref.Symbol
+	}
+
+	if ref.IsMember {
+		if Grimoire := st.Grimoires[ref.Receiver]; Grimoire != nil {
+			return st.LookupMember(Grimoire, ref.Name)
+		}
+		return nil
+	}
+
+	return st.LookupGlobalSymbol(ref.Name, ref.URI)
+}
+
+// LookupGlobalSymbol finds a top-level symbol by name, preferring the given file
+func (st *SymbolTable) LookupGlobalSymbol(name string, uri string) *Symbol {
+	if fileScope, ok := st.FileScopes[uri]; ok {
+		if symbol, ok := fileScope.Symbols[name]; ok {
+			return symbol
+		}
+	}
+
+	if symbol := st.ImportedSymbol(name, uri); symbol != nil {
+		return symbol
+	}
+
+	for _, fileScope := range st.FileScopes {
+		if symbol, ok := fileScope.Symbols[name]; ok {
+			if symbol.Type == "Grimoire" || symbol.Type == "spell" {
+				return symbol
+			}
+		}
+	}
+
+	return st.Global.Symbols[name]
+}
+
+// FindReferences returns every occurrence of the given symbol across all
+// analyzed files
+func (st *SymbolTable) FindReferences(target *Symbol, includeDeclaration bool) []*Reference {
+	if target == nil {
+		return nil
+	}
+
+	isMember := target.Type == "method" || target.Type == "field"
+	isGlobal := !isMember && st.isTopLevel(target)
+
+	refs := make([]*Reference, 0)
+	for _, fileRefs := range st.References {
+		for _, ref := range fileRefs {
+			if ref.Name != target.Name || (ref.IsDeclaration && !includeDeclaration) {
+				continue
+			}
+
+			switch {
+			case ref.Symbol == target:
+			case isMember && ref.IsMember:
+				// Grimoires are rebuilt per file, so members are matched by
+				// name and the Grimoire defining them rather than by identity
+				if ref.Receiver != "" && st.memberOwner(ref.Receiver, ref.Name) != target.GrimoireName {
+					continue
+				}
+			case isGlobal && !ref.IsMember && ref.Symbol == nil:
+				// Names defined in other files are left unresolved
+			default:
+				continue
+			}
+
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs
+}
+
+// isTopLevel reports whether a symbol is defined directly in a file scope
+func (st *SymbolTable) isTopLevel(symbol *Symbol) bool {
+	fileScope, ok := st.FileScopes[symbol.DefinitionURI]
+	if !ok {
+		return false
+	}
+	return fileScope.Symbols[symbol.Name] == symbol
+}
@@ -0,0 +1,497 @@
+package symbols
+
+import (
+	"strings"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	"github.com/javanhut/TheCarrionLanguage/src/token"
+)
+
+// Span is the extent of a node in the source, with 0-based lines and byte
+// columns. The end is exclusive.
+type Span struct {
+	StartLine   int
+	StartColumn int
+	EndLine     int
+	EndColumn   int
+}
+
+// noSpan is the span of nodes without position information
+var noSpan = Span{StartLine: -1, StartColumn: -1, EndLine: -1, EndColumn: -1}
+
+// IsValid reports whether the span carries a position
+func (s Span) IsValid() bool {
+	return s.StartLine >= 0
+}
+
+// Contains reports whether a 0-based position falls within the span, its end
+// included so that a cursor right after a name still selects it
+func (s Span) Contains(line, column int) bool {
+	if !s.IsValid() || line < s.StartLine || line > s.EndLine {
+		return false
+	}
+	if line == s.StartLine && column < s.StartColumn {
+		return false
+	}
+	return line != s.EndLine || column <= s.EndColumn
+}
+
+// union returns the smallest span covering both spans
+func (s Span) union(other Span) Span {
+	if !other.IsValid() {
+		return s
+	}
+	if !s.IsValid() {
+		return other
+	}
+	if other.StartLine < s.StartLine || (other.StartLine == s.StartLine && other.StartColumn < s.StartColumn) {
+		s.StartLine, s.StartColumn = other.StartLine, other.StartColumn
+	}
+	if other.EndLine > s.EndLine || (other.EndLine == s.EndLine && other.EndColumn > s.EndColumn) {
+		s.EndLine, s.EndColumn = other.EndLine, other.EndColumn
+	}
+	return s
+}
+
+// PositionMap computes the exact spans of the nodes of a parsed document.
+//
+// Tokens only record where they start, so ends are found in the source text:
+// the closing quote of a string, the closing bracket of a call or literal.
+type PositionMap struct {
+	lines []string
+	spans map[ast.Node]Span
+}
+
+// NewPositionMap creates a position map for the given source text
+func NewPositionMap(text string) *PositionMap {
+	return &PositionMap{
+		lines: strings.Split(text, "\n"),
+		spans: make(map[ast.Node]Span),
+	}
+}
+
+// Span returns the extent of a node, from its first token to the end of its
+// last one
+func (m *PositionMap) Span(node ast.Node) Span {
+	if isNilNode(node) {
+		return noSpan
+	}
+	if span, ok := m.spans[node]; ok {
+		return span
+	}
+
+	span := m.computeSpan(node)
+	m.spans[node] = span
+	return span
+}
+
+// computeSpan returns the extent of a node, covering its own token and those
+// of its children
+func (m *PositionMap) computeSpan(node ast.Node) Span {
+	span := noSpan
+	for _, child := range Children(node) {
+		span = span.union(m.Span(child))
+	}
+
+	switch n := node.(type) {
+	case *ast.Program:
+		return span
+	case *ast.BlockStatement:
+		// The block token is the colon or indent before the statements
+		if !span.IsValid() {
+			span = m.tokenSpan(n.Token)
+		}
+		return span
+	case *ast.ArrayLiteral:
+		return span.union(m.bracketSpan(n.Token))
+	case *ast.HashLiteral:
+		return span.union(m.bracketSpan(n.Token))
+	case *ast.TupleLiteral:
+		return span.union(m.bracketSpan(n.Token))
+	case *ast.CallExpression:
+		if function := m.Span(n.Function); function.IsValid() {
+			return span.union(m.bracketAfter(function, '('))
+		}
+		return span.union(m.bracketSpan(n.Token))
+	case *ast.IndexExpression:
+		if left := m.Span(n.Left); left.IsValid() {
+			return span.union(m.bracketAfter(left, '['))
+		}
+		return span.union(m.bracketSpan(n.Token))
+	case *ast.InfixExpression, *ast.DotExpression:
+		// The token is the operator, between the operands
+		return span
+	}
+
+	if tok, ok := nodeToken(node); ok {
+		span = span.union(m.tokenSpan(tok))
+	}
+	return span
+}
+
+// tokenSpan returns the extent of a token
+func (m *PositionMap) tokenSpan(tok token.Token) Span {
+	line, column := tok.Line-1, tok.Column-1
+	if line < 0 || column < 0 || line >= len(m.lines) {
+		return noSpan
+	}
+
+	text := m.lines[line]
+	if column > len(text) {
+		column = len(text)
+	}
+	rest := text[column:]
+
+	switch {
+	case strings.HasPrefix(rest, "```"):
+		if endLine, endColumn, ok := m.findText(line, column+3, "```"); ok {
+			return Span{line, column, endLine, endColumn}
+		}
+	case strings.HasPrefix(rest, `f"`), strings.HasPrefix(rest, "f'"):
+		if end, ok := closingQuote(text, column+1); ok {
+			return Span{line, column, line, end}
+		}
+	case strings.HasPrefix(rest, `"`), strings.HasPrefix(rest, "'"):
+		if end, ok := closingQuote(text, column); ok {
+			return Span{line, column, line, end}
+		}
+	case tok.Literal != "" && strings.HasPrefix(rest, tok.Literal):
+		return Span{line, column, line, column + len(tok.Literal)}
+	}
+
+	end := column
+	for end < len(text) && isWordByte(text[end]) {
+		end++
+	}
+	if end == column && end < len(text) {
+		end++
+	}
+	return Span{line, column, line, end}
+}
+
+// TokenSpanAt returns the extent of the token starting at a 0-based
+// position, such as the one a parse error is reported at. The span is empty
+// at the end of a line.
+func (m *PositionMap) TokenSpanAt(line, column int) Span {
+	return m.tokenSpan(token.Token{Line: line + 1, Column: column + 1})
+}
+
+// bracketSpan returns the extent of a bracketed construct whose token is the
+// opening bracket
+func (m *PositionMap) bracketSpan(tok token.Token) Span {
+	span := m.tokenSpan(tok)
+	if !span.IsValid() {
+		return noSpan
+	}
+	if endLine, endColumn, ok := m.matchBracket(span.StartLine, span.StartColumn); ok {
+		span.EndLine, span.EndColumn = endLine, endColumn
+	}
+	return span
+}
+
+// bracketAfter returns the extent of the brackets opening right after a span,
+// such as the arguments of a call
+func (m *PositionMap) bracketAfter(span Span, open byte) Span {
+	if span.EndLine >= len(m.lines) {
+		return noSpan
+	}
+
+	text := m.lines[span.EndLine]
+	column := span.EndColumn
+	for column < len(text) && (text[column] == ' ' || text[column] == '\t') {
+		column++
+	}
+	if column >= len(text) || text[column] != open {
+		return noSpan
+	}
+
+	endLine, endColumn, ok := m.matchBracket(span.EndLine, column)
+	if !ok {
+		return noSpan
+	}
+	return Span{span.EndLine, column, endLine, endColumn}
+}
+
+// matchBracket returns the position right after the bracket closing the one
+// at the given position, skipping strings and comments
+func (m *PositionMap) matchBracket(line, column int) (int, int, bool) {
+	depth := 0
+	for ; line < len(m.lines); line, column = line+1, 0 {
+		text := m.lines[line]
+		for i := column; i < len(text); i++ {
+			switch c := text[i]; c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth--
+				if depth == 0 {
+					return line, i + 1, true
+				}
+			case '"', '\'':
+				end, ok := closingQuote(text, i)
+				if !ok {
+					return 0, 0, false
+				}
+				i = end - 1
+			case '#':
+				i = len(text)
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// findText returns the position right after the next occurrence of s from
+// the given position
+func (m *PositionMap) findText(line, column int, s string) (int, int, bool) {
+	for ; line < len(m.lines); line, column = line+1, 0 {
+		text := m.lines[line]
+		if column > len(text) {
+			continue
+		}
+		if i := strings.Index(text[column:], s); i >= 0 {
+			return line, column + i + len(s), true
+		}
+	}
+	return 0, 0, false
+}
+
+// closingQuote returns the column right after the quote closing the string
+// that starts at the given column
+func closingQuote(text string, column int) (int, bool) {
+	quote := text[column]
+	for i := column + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// isWordByte reports whether c may be part of a name or number
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// NodeAt returns the chain of nodes containing a 0-based position, from the
+// innermost node up to the top-level statement holding it
+func (m *PositionMap) NodeAt(program *ast.Program, line, column int) []ast.Node {
+	chain := make([]ast.Node, 0)
+
+	var node ast.Node = program
+	for {
+		var inner ast.Node
+		for _, child := range Children(node) {
+			if m.Span(child).Contains(line, column) {
+				inner = child
+				break
+			}
+		}
+		if inner == nil {
+			break
+		}
+		chain = append(chain, inner)
+		node = inner
+	}
+
+	// Innermost first
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// Children returns the nodes directly nested in a node, in source order
+func Children(node ast.Node) []ast.Node {
+	children := make([]ast.Node, 0)
+	add := func(nodes ...ast.Node) {
+		for _, child := range nodes {
+			if !isNilNode(child) {
+				children = append(children, child)
+			}
+		}
+	}
+
+	switch n := node.(type) {
+	case *ast.Program:
+		for _, stmt := range n.Statements {
+			add(stmt)
+		}
+	case *ast.BlockStatement:
+		if n != nil {
+			for _, stmt := range n.Statements {
+				add(stmt)
+			}
+		}
+	case *ast.GrimoireDefinition:
+		add(n.Name, n.Inherits, n.DocString)
+		methods := make([]*ast.FunctionDefinition, 0, len(n.Methods)+1)
+		if n.InitMethod != nil {
+			methods = append(methods, n.InitMethod)
+		}
+		methods = append(methods, n.Methods...)
+		for _, method := range sortedByLine(methods) {
+			add(method)
+		}
+	case *ast.FunctionDefinition:
+		add(n.Name)
+		for _, param := range n.Parameters {
+			add(param)
+		}
+		add(n.DocString, n.Body)
+	case *ast.Parameter:
+		add(n.Name, n.TypeHint, n.DefaultValue)
+	case *ast.AssignStatement:
+		add(n.Name, n.TypeHint, n.Value)
+	case *ast.ExpressionStatement:
+		add(n.Expression)
+	case *ast.ReturnStatement:
+		add(n.ReturnValue)
+	case *ast.RaiseStatement:
+		add(n.Error)
+	case *ast.ImportStatement:
+		add(n.FilePath, n.ClassName, n.Alias)
+	case *ast.IfStatement:
+		add(n.Condition, n.Consequence)
+		for _, branch := range n.OtherwiseBranches {
+			add(branch.Condition, branch.Consequence)
+		}
+		add(n.Alternative)
+	case *ast.ForStatement:
+		add(n.Variable, n.Iterable, n.Body, n.Alternative)
+	case *ast.WhileStatement:
+		add(n.Condition, n.Body)
+	case *ast.MatchStatement:
+		add(n.MatchValue)
+		for _, c := range n.Cases {
+			add(c)
+		}
+		add(n.Default)
+	case *ast.CaseClause:
+		add(n.Condition, n.Body)
+	case *ast.AttemptStatement:
+		add(n.TryBlock)
+		for _, ensnare := range n.EnsnareClauses {
+			add(ensnare)
+		}
+		add(n.ResolveBlock)
+	case *ast.EnsnareClause:
+		add(n.Condition, n.Alias, n.Consequence)
+	case *ast.PrefixExpression:
+		add(n.Right)
+	case *ast.InfixExpression:
+		add(n.Left, n.Right)
+	case *ast.CallExpression:
+		add(n.Function)
+		for _, arg := range n.Arguments {
+			add(arg)
+		}
+	case *ast.DotExpression:
+		add(n.Left, n.Right)
+	case *ast.IndexExpression:
+		add(n.Left, n.Index)
+	case *ast.ArrayLiteral:
+		for _, elem := range n.Elements {
+			add(elem)
+		}
+	case *ast.TupleLiteral:
+		for _, elem := range n.Elements {
+			add(elem)
+		}
+	case *ast.HashLiteral:
+		for key, value := range n.Pairs {
+			add(key, value)
+		}
+	}
+
+	return children
+}
+
+// sortedByLine orders method definitions by their position
+func sortedByLine(methods []*ast.FunctionDefinition) []*ast.FunctionDefinition {
+	for i := 1; i < len(methods); i++ {
+		for j := i; j > 0 && methods[j].Token.Line < methods[j-1].Token.Line; j-- {
+			methods[j], methods[j-1] = methods[j-1], methods[j]
+		}
+	}
+	return methods
+}
+
+// nodeToken returns the token a node starts at, for the nodes that have one
+func nodeToken(node ast.Node) (token.Token, bool) {
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return n.Token, true
+	case *ast.StringLiteral:
+		return n.Token, true
+	case *ast.IntegerLiteral:
+		return n.Token, true
+	case *ast.FloatLiteral:
+		return n.Token, true
+	case *ast.Boolean:
+		return n.Token, true
+	case *ast.NoneLiteral:
+		return n.Token, true
+	case *ast.PrefixExpression:
+		return n.Token, true
+	case *ast.Parameter:
+		if n.Name != nil {
+			return n.Name.Token, true
+		}
+	case *ast.AssignStatement:
+		return n.Token, true
+	case *ast.ExpressionStatement:
+		return n.Token, true
+	case *ast.ReturnStatement:
+		return n.Token, true
+	case *ast.RaiseStatement:
+		return n.Token, true
+	case *ast.ImportStatement:
+		return n.Token, true
+	case *ast.GrimoireDefinition:
+		return n.Token, true
+	case *ast.FunctionDefinition:
+		return n.Token, true
+	case *ast.IfStatement:
+		return n.Token, true
+	case *ast.ForStatement:
+		return n.Token, true
+	case *ast.WhileStatement:
+		return n.Token, true
+	case *ast.MatchStatement:
+		return n.Token, true
+	case *ast.CaseClause:
+		return n.Token, true
+	case *ast.AttemptStatement:
+		return n.Token, true
+	case *ast.EnsnareClause:
+		return n.Token, true
+	}
+	return token.Token{}, false
+}
+
+// isNilNode reports whether a node is nil, including typed nil pointers held
+// by interface fields
+func isNilNode(node ast.Node) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *ast.Identifier:
+		return n == nil
+	case *ast.StringLiteral:
+		return n == nil
+	case *ast.BlockStatement:
+		return n == nil
+	case *ast.FunctionDefinition:
+		return n == nil
+	case *ast.CaseClause:
+		return n == nil
+	case *ast.EnsnareClause:
+		return n == nil
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package symbols
 
 import (
+	"strings"
+
 	"github.com/javanhut/TheCarrionLanguage/src/ast"
 	"github.com/javanhut/TheCarrionLanguage/src/token"
 )
@@ -24,6 +26,11 @@ type Symbol struct {
 	DefinitionLine   int
 	DefinitionColumn int
 	Scope            *Scope
+	References       []*Reference
+	Declaration      *Reference
+	// Binding is the statement that assigned a variable, nil for variables
+	// bound by loops or ensnare clauses
+	Binding ast.Statement
 }
 
 // GrimoireSymbol represents a Grimoire declaration
@@ -45,6 +52,17 @@ type Scope struct {
 	EndLine   int
 	Grimoire  *GrimoireSymbol
 	URI       string
+	// UnknownReads is set when the scope or a scope nested in it holds code
+	// whose names are not recorded, so its variables may be read unseen
+	UnknownReads bool
+}
+
+// markUnknownReads records that the scope and those enclosing it hold code
+// whose names are not recorded
+func (s *Scope) markUnknownReads() {
+	for scope := s; scope != nil && !scope.UnknownReads; scope = scope.Parent {
+		scope.UnknownReads = true
+	}
 }
 
 // SymbolTable maintains symbols for the entire codebase
@@ -52,6 +70,8 @@ type SymbolTable struct {
 	Global     *Scope
 	Grimoires  map[string]*GrimoireSymbol
 	FileScopes map[string]*Scope
+	References map[string][]*Reference
+	Imports    map[string][]*Import
 	CurrentURI string
 }
 
@@ -66,11 +86,44 @@ func NewSymbolTable() *SymbolTable {
 		Global:     globalScope,
 		Grimoires:  make(map[string]*GrimoireSymbol),
 		FileScopes: make(map[string]*Scope),
+		References: make(map[string][]*Reference),
+		Imports:    make(map[string][]*Import),
+	}
+}
+
+// Clone returns a copy of the table that can be changed without affecting
+// the original. Symbols and scopes are shared, as building or removing a file
+// replaces those of the file instead of modifying them.
+func (st *SymbolTable) Clone() *SymbolTable {
+	clone := &SymbolTable{
+		Global:     st.Global,
+		Grimoires:  make(map[string]*GrimoireSymbol, len(st.Grimoires)),
+		FileScopes: make(map[string]*Scope, len(st.FileScopes)),
+		References: make(map[string][]*Reference, len(st.References)),
+		Imports:    make(map[string][]*Import, len(st.Imports)),
+		CurrentURI: st.CurrentURI,
+	}
+	for name, Grimoire := range st.Grimoires {
+		clone.Grimoires[name] = Grimoire
 	}
+	for uri, scope := range st.FileScopes {
+		clone.FileScopes[uri] = scope
+	}
+	for uri, refs := range st.References {
+		clone.References[uri] = refs
+	}
+	for uri, imports := range st.Imports {
+		clone.Imports[uri] = imports
+	}
+	return clone
 }
 
-// BuildFromAST builds the symbol table from an AST
-func (st *SymbolTable) BuildFromAST(program *ast.Program, uri string) {
+// BuildFromAST builds the symbol table from the AST of a file and the source
+// text it was parsed from
+func (st *SymbolTable) BuildFromAST(program *ast.Program, uri string, text string) {
+	// Drop what a previous analysis of the file contributed
+	st.RemoveFile(uri)
+
 	fileScope := &Scope{
 		Parent:    st.Global,
 		Symbols:   make(map[string]*Symbol),
@@ -80,11 +133,16 @@ func (st *SymbolTable) BuildFromAST(program *ast.Program, uri string) {
 	st.FileScopes[uri] = fileScope
 	st.CurrentURI = uri
 
-	// First pass: collect Grimoires and top-level spells
+	// First pass: collect imports, Grimoires and top-level spells
+	lines := strings.Split(text, "\n")
 	for _, stmt := range program.Statements {
 		switch node := stmt.(type) {
+		case *ast.ImportStatement:
+			st.processImportStatement(node, fileScope, lines)
 		case *ast.GrimoireDefinition:
 			st.processGrimoireDefinition(node, fileScope)
+		case *ast.ArcaneGrimoire:
+			st.processGrimoireDefinition(arcaneGrimoireDefinition(node), fileScope)
 		case *ast.FunctionDefinition:
 			st.processFunctionDefinition(node, fileScope)
 		case *ast.AssignStatement:
@@ -92,13 +150,75 @@ func (st *SymbolTable) BuildFromAST(program *ast.Program, uri string) {
 		}
 	}
 
-	// Second pass: process function bodies and resolve references
+	// Second pass: process function bodies and the remaining top-level code
 	for _, stmt := range program.Statements {
 		switch node := stmt.(type) {
 		case *ast.FunctionDefinition:
 			st.processFunctionBody(node, fileScope)
+		case *ast.ImportStatement, *ast.GrimoireDefinition, *ast.AssignStatement:
+		default:
+			st.processStatementForSymbols(stmt, fileScope)
 		}
 	}
+	st.collectInterpolationReferences(fileScope, text)
+
+	// Resolve references now that every symbol in the file is known
+	st.resolveReferences(uri)
+}
+
+// RemoveFile drops every symbol and reference contributed by a file. A
+// Grimoire that another file also defines falls back to that definition.
+func (st *SymbolTable) RemoveFile(uri string) {
+	delete(st.FileScopes, uri)
+	delete(st.References, uri)
+	delete(st.Imports, uri)
+
+	for name, Grimoire := range st.Grimoires {
+		if Grimoire.DefinitionURI == uri {
+			delete(st.Grimoires, name)
+			st.restoreGrimoire(name)
+		}
+	}
+
+	// References from other files may point at members of the removed file.
+	// They are replaced by unresolved copies, as clones share them.
+	for fileURI, fileRefs := range st.References {
+		copied := false
+		for i, ref := range fileRefs {
+			if ref.Symbol == nil || ref.Symbol.DefinitionURI != uri {
+				continue
+			}
+			if !copied {
+				fileRefs = append([]*Reference(nil), fileRefs...)
+				copied = true
+			}
+			unresolved := *ref
+			unresolved.Symbol = nil
+			fileRefs[i] = &unresolved
+		}
+		if copied {
+			st.References[fileURI] = fileRefs
+		}
+	}
+}
+
+// restoreGrimoire registers the definition of a Grimoire from the first
+// remaining file that defines it, if any
+func (st *SymbolTable) restoreGrimoire(name string) {
+	var restored *GrimoireSymbol
+	for uri, fileScope := range st.FileScopes {
+		symbol, ok := fileScope.Symbols[name]
+		if !ok || symbol.Type != "Grimoire" || symbol.Scope == nil || symbol.Scope.Grimoire == nil {
+			continue
+		}
+		if restored == nil || uri < restored.DefinitionURI {
+			restored = symbol.Scope.Grimoire
+		}
+	}
+
+	if restored != nil {
+		st.Grimoires[name] = restored
+	}
 }
 
 // processGrimoireDefinition processes a Grimoire definition
@@ -127,10 +247,12 @@ func (st *SymbolTable) processGrimoireDefinition(node *ast.GrimoireDefinition, s
 	}
 
 	GrimoireScope := &Scope{
-		Parent:   scope,
-		Symbols:  make(map[string]*Symbol),
-		Grimoire: Grimoire,
-		URI:      st.CurrentURI,
+		Parent:    scope,
+		Symbols:   make(map[string]*Symbol),
+		StartLine: line,
+		EndLine:   LastLine(node),
+		Grimoire:  Grimoire,
+		URI:       st.CurrentURI,
 	}
 
 	GrimoireSymbol := &Symbol{
@@ -145,6 +267,10 @@ func (st *SymbolTable) processGrimoireDefinition(node *ast.GrimoireDefinition, s
 
 	scope.Symbols[GrimoireName] = GrimoireSymbol
 	st.Grimoires[GrimoireName] = Grimoire
+	st.addDeclaration(node.Name, scope, GrimoireSymbol)
+	if node.Inherits != nil {
+		st.addReference(node.Inherits, scope)
+	}
 
 	for _, method := range node.Methods {
 		st.processMethod(method, GrimoireScope, Grimoire)
@@ -155,6 +281,28 @@ func (st *SymbolTable) processGrimoireDefinition(node *ast.GrimoireDefinition, s
 	}
 }
 
+// arcaneGrimoireDefinition describes an arcane Grimoire as a Grimoire whose
+// methods are its @arcanespell declarations, which have no body
+func arcaneGrimoireDefinition(node *ast.ArcaneGrimoire) *ast.GrimoireDefinition {
+	definition := &ast.GrimoireDefinition{
+		Token:      node.Token,
+		Name:       node.Name,
+		InitMethod: node.InitMethod,
+	}
+	for _, method := range node.Methods {
+		if method == nil || method.Name == nil {
+			continue
+		}
+		definition.Methods = append(definition.Methods, &ast.FunctionDefinition{
+			Token:      method.Token,
+			Name:       method.Name,
+			Parameters: method.Parameters,
+			Body:       method.Body,
+		})
+	}
+	return definition
+}
+
 func extractPositionFromToken(tok token.Token) struct{ Line, Column int } {
 	// Extract line and column from the token
 	// Tokens in Carrion have Line and Column fields
@@ -179,24 +327,10 @@ func (st *SymbolTable) processMethod(
 	column = tokenPos.Column
 
 	params := make([]Parameter, 0, len(node.Parameters))
-	for _, p := range node.Parameters {
-		// Type assert the Expression to *Parameter
-		if paramNode, ok := p.(*ast.Parameter); ok {
-			param := Parameter{
-				Name: paramNode.Name.Value,
-			}
-
-			if paramNode.TypeHint != nil {
-				if typeIdent, ok := paramNode.TypeHint.(*ast.Identifier); ok {
-					param.TypeHint = typeIdent.Value
-				}
-			}
-
-			if paramNode.DefaultValue != nil {
-				param.DefaultValue = paramNode.DefaultValue.String()
-			}
-
-			params = append(params, param)
+	for _, paramNode := range parameterNodes(node) {
+		// self is implicit and always defined below
+		if paramNode.Name.Value != "self" {
+			params = append(params, newParameter(paramNode))
 		}
 	}
 
@@ -215,11 +349,13 @@ func (st *SymbolTable) processMethod(
 	}
 
 	Grimoire.Methods = append(Grimoire.Methods, methodSymbol)
+	st.addDeclaration(node.Name, scope, methodSymbol)
 
 	methodScope := &Scope{
 		Parent:    scope,
 		Symbols:   make(map[string]*Symbol),
 		StartLine: line,
+		EndLine:   LastLine(node),
 		URI:       st.CurrentURI,
 	}
 
@@ -244,6 +380,7 @@ func (st *SymbolTable) processMethod(
 		}
 		methodScope.Symbols[param.Name] = paramSymbol
 	}
+	st.processParameterDeclarations(node, methodScope)
 
 	if node.Body != nil {
 		for _, stmt := range node.Body.Statements {
@@ -263,31 +400,15 @@ func (st *SymbolTable) processFunctionDefinition(node *ast.FunctionDefinition, s
 	column = tokenPos.Column
 
 	params := make([]Parameter, 0, len(node.Parameters))
-	for _, p := range node.Parameters {
-		// Type assert the Expression to *Parameter
-		if paramNode, ok := p.(*ast.Parameter); ok {
-			param := Parameter{
-				Name: paramNode.Name.Value,
-			}
-
-			if paramNode.TypeHint != nil {
-				if typeIdent, ok := paramNode.TypeHint.(*ast.Identifier); ok {
-					param.TypeHint = typeIdent.Value
-				}
-			}
-
-			if paramNode.DefaultValue != nil {
-				param.DefaultValue = paramNode.DefaultValue.String()
-			}
-
-			params = append(params, param)
-		}
+	for _, paramNode := range parameterNodes(node) {
+		params = append(params, newParameter(paramNode))
 	}
 
 	funcScope := &Scope{
 		Parent:    scope,
 		Symbols:   make(map[string]*Symbol),
 		StartLine: line,
+		EndLine:   LastLine(node),
 		URI:       st.CurrentURI,
 	}
 
@@ -306,6 +427,7 @@ func (st *SymbolTable) processFunctionDefinition(node *ast.FunctionDefinition, s
 	}
 
 	scope.Symbols[funcName] = funcSymbol
+	st.addDeclaration(node.Name, scope, funcSymbol)
 
 	for _, param := range params {
 		paramSymbol := &Symbol{
@@ -317,6 +439,57 @@ func (st *SymbolTable) processFunctionDefinition(node *ast.FunctionDefinition, s
 		}
 		funcScope.Symbols[param.Name] = paramSymbol
 	}
+	st.processParameterDeclarations(node, funcScope)
+}
+
+// parameterNodes returns the parameters of a spell. The parser keeps plain
+// parameters as identifiers and only builds Parameter nodes for those with a
+// type hint or a default value, so identifiers are wrapped into one.
+func parameterNodes(node *ast.FunctionDefinition) []*ast.Parameter {
+	params := make([]*ast.Parameter, 0, len(node.Parameters))
+	for _, p := range node.Parameters {
+		switch param := p.(type) {
+		case *ast.Parameter:
+			if param.Name != nil {
+				params = append(params, param)
+			}
+		case *ast.Identifier:
+			params = append(params, &ast.Parameter{Name: param})
+		}
+	}
+	return params
+}
+
+// newParameter describes a parameter node
+func newParameter(node *ast.Parameter) Parameter {
+	param := Parameter{
+		Name: node.Name.Value,
+	}
+
+	if node.TypeHint != nil {
+		if typeIdent, ok := node.TypeHint.(*ast.Identifier); ok {
+			param.TypeHint = typeIdent.Value
+		}
+	}
+
+	if node.DefaultValue != nil {
+		param.DefaultValue = node.DefaultValue.String()
+	}
+
+	return param
+}
+
+// processParameterDeclarations records parameter names and the names used by
+// their default values
+func (st *SymbolTable) processParameterDeclarations(node *ast.FunctionDefinition, scope *Scope) {
+	for _, paramNode := range parameterNodes(node) {
+		if symbol, ok := scope.Symbols[paramNode.Name.Value]; ok {
+			st.addDeclaration(paramNode.Name, scope, symbol)
+		}
+		if paramNode.DefaultValue != nil {
+			st.collectExpressionReferences(paramNode.DefaultValue, scope.Parent)
+		}
+	}
 }
 
 // processFunctionBody processes the body of a function to collect local variables
@@ -335,6 +508,10 @@ func (st *SymbolTable) processFunctionBody(node *ast.FunctionDefinition, scope *
 
 // processAssignStatement processes an assignment statement
 func (st *SymbolTable) processAssignStatement(node *ast.AssignStatement, scope *Scope) {
+	if node.Value != nil {
+		st.collectExpressionReferences(node.Value, scope)
+	}
+
 	switch target := node.Name.(type) {
 	case *ast.Identifier:
 		line := 0
@@ -346,6 +523,15 @@ func (st *SymbolTable) processAssignStatement(node *ast.AssignStatement, scope *
 
 		varName := target.Value
 
+		// Reassignments keep the original definition. Compound assignments
+		// such as += read the variable first, so they are recorded as reads.
+		if _, exists := scope.Symbols[varName]; exists {
+			if ref := st.addReference(target, scope); ref != nil {
+				ref.IsWrite = !isCompoundAssignment(node)
+			}
+			return
+		}
+
 		if scope.Grimoire != nil {
 			fieldSymbol := &Symbol{
 				Name:             varName,
@@ -358,6 +544,7 @@ func (st *SymbolTable) processAssignStatement(node *ast.AssignStatement, scope *
 
 			scope.Symbols[varName] = fieldSymbol
 			scope.Grimoire.Fields = append(scope.Grimoire.Fields, fieldSymbol)
+			st.addDeclaration(target, scope, fieldSymbol)
 		} else {
 			varSymbol := &Symbol{
 				Name:             varName,
@@ -365,6 +552,7 @@ func (st *SymbolTable) processAssignStatement(node *ast.AssignStatement, scope *
 				DefinitionURI:    st.CurrentURI,
 				DefinitionLine:   line,
 				DefinitionColumn: column,
+				Binding:          node,
 			}
 
 			if node.TypeHint != nil {
@@ -385,16 +573,92 @@ func (st *SymbolTable) processAssignStatement(node *ast.AssignStatement, scope *
 			}
 
 			scope.Symbols[varName] = varSymbol
+			st.addDeclaration(target, scope, varSymbol)
 		}
+
+	case *ast.DotExpression:
+		st.collectExpressionReferences(target.Left, scope)
+
+		// Assignments to self.<name> inside methods define Grimoire fields
+		Grimoire := scope.EnclosingGrimoire()
+		if receiver, ok := target.Left.(*ast.Identifier); ok && receiver.Value == "self" &&
+			Grimoire != nil && target.Right != nil && st.LookupMember(Grimoire, target.Right.Value) == nil {
+			tokenPos := extractPositionFromToken(target.Right.Token)
+			fieldSymbol := &Symbol{
+				Name:             target.Right.Value,
+				Type:             "field",
+				GrimoireName:     Grimoire.Name,
+				DefinitionURI:    st.CurrentURI,
+				DefinitionLine:   tokenPos.Line,
+				DefinitionColumn: tokenPos.Column,
+			}
+			Grimoire.Fields = append(Grimoire.Fields, fieldSymbol)
+			st.addDeclaration(target.Right, scope, fieldSymbol)
+			return
+		}
+
+		if ref := st.addMemberReference(target, scope); ref != nil {
+			ref.IsWrite = true
+		}
+
+	case *ast.IndexExpression:
+		st.collectExpressionReferences(target, scope)
 	}
 }
 
+// isCompoundAssignment reports whether an assignment combines the variable
+// with the value, as += does
+func isCompoundAssignment(node *ast.AssignStatement) bool {
+	return node.Operator != "" && node.Operator != "="
+}
+
+// declareVariable defines a variable bound by a loop or an ensnare clause
+func (st *SymbolTable) declareVariable(ident *ast.Identifier, tok token.Token, scope *Scope) {
+	if _, exists := scope.Symbols[ident.Value]; exists {
+		if ref := st.addReference(ident, scope); ref != nil {
+			ref.IsWrite = true
+		}
+		return
+	}
+
+	tokenPos := extractPositionFromToken(tok)
+	symbol := &Symbol{
+		Name:           ident.Value,
+		Type:           "variable",
+		DefinitionURI:  st.CurrentURI,
+		DefinitionLine: tokenPos.Line,
+	}
+	scope.Symbols[ident.Value] = symbol
+	st.addDeclaration(ident, scope, symbol)
+}
+
 // processStatementForSymbols processes statements to collect symbols
 func (st *SymbolTable) processStatementForSymbols(stmt ast.Statement, scope *Scope) {
 	switch node := stmt.(type) {
 	case *ast.AssignStatement:
 		st.processAssignStatement(node, scope)
 
+	case *ast.ExpressionStatement:
+		st.collectExpressionReferences(node.Expression, scope)
+
+	case *ast.ReturnStatement:
+		st.collectExpressionReferences(node.ReturnValue, scope)
+
+	case *ast.RaiseStatement:
+		st.collectExpressionReferences(node.Error, scope)
+
+	case *ast.CheckStatement:
+		st.collectExpressionReferences(node.Condition, scope)
+		st.collectExpressionReferences(node.Message, scope)
+
+	case *ast.FunctionDefinition:
+		// Spells and Grimoires nested in a spell see its variables
+		st.processFunctionDefinition(node, scope)
+		st.processFunctionBody(node, scope)
+
+	case *ast.GrimoireDefinition:
+		st.processGrimoireDefinition(node, scope)
+
 	case *ast.BlockStatement:
 		blockScope := &Scope{
 			Parent:  scope,
@@ -407,6 +671,7 @@ func (st *SymbolTable) processStatementForSymbols(stmt ast.Statement, scope *Sco
 		}
 
 	case *ast.IfStatement:
+		st.collectExpressionReferences(node.Condition, scope)
 		if node.Consequence != nil {
 			for _, s := range node.Consequence.Statements {
 				st.processStatementForSymbols(s, scope)
@@ -414,6 +679,7 @@ func (st *SymbolTable) processStatementForSymbols(stmt ast.Statement, scope *Sco
 		}
 
 		for _, branch := range node.OtherwiseBranches {
+			st.collectExpressionReferences(branch.Condition, scope)
 			if branch.Consequence != nil {
 				for _, s := range branch.Consequence.Statements {
 					st.processStatementForSymbols(s, scope)
@@ -428,34 +694,16 @@ func (st *SymbolTable) processStatementForSymbols(stmt ast.Statement, scope *Sco
 		}
 
 	case *ast.ForStatement:
+		st.collectExpressionReferences(node.Iterable, scope)
+
 		switch v := node.Variable.(type) {
 		case *ast.Identifier:
-			line := 0
-			tokenPos := extractPositionFromToken(node.Token)
-			line = tokenPos.Line
-
-			loopVarSymbol := &Symbol{
-				Name:           v.Value,
-				Type:           "variable",
-				DefinitionURI:  st.CurrentURI,
-				DefinitionLine: line,
-			}
-			scope.Symbols[v.Value] = loopVarSymbol
+			st.declareVariable(v, node.Token, scope)
 
 		case *ast.TupleLiteral:
-			line := 0
-			tokenPos := extractPositionFromToken(node.Token)
-			line = tokenPos.Line
-
 			for _, elem := range v.Elements {
 				if ident, ok := elem.(*ast.Identifier); ok {
-					loopVarSymbol := &Symbol{
-						Name:           ident.Value,
-						Type:           "variable",
-						DefinitionURI:  st.CurrentURI,
-						DefinitionLine: line,
-					}
-					scope.Symbols[ident.Value] = loopVarSymbol
+					st.declareVariable(ident, node.Token, scope)
 				}
 			}
 		}
@@ -473,12 +721,30 @@ func (st *SymbolTable) processStatementForSymbols(stmt ast.Statement, scope *Sco
 		}
 
 	case *ast.WhileStatement:
+		st.collectExpressionReferences(node.Condition, scope)
 		if node.Body != nil {
 			for _, s := range node.Body.Statements {
 				st.processStatementForSymbols(s, scope)
 			}
 		}
 
+	case *ast.MatchStatement:
+		st.collectExpressionReferences(node.MatchValue, scope)
+		for _, c := range node.Cases {
+			st.collectExpressionReferences(c.Condition, scope)
+			if c.Body != nil {
+				for _, s := range c.Body.Statements {
+					st.processStatementForSymbols(s, scope)
+				}
+			}
+		}
+
+		if node.Default != nil && node.Default.Body != nil {
+			for _, s := range node.Default.Body.Statements {
+				st.processStatementForSymbols(s, scope)
+			}
+		}
+
 	case *ast.AttemptStatement:
 		if node.TryBlock != nil {
 			for _, s := range node.TryBlock.Statements {
@@ -487,18 +753,9 @@ func (st *SymbolTable) processStatementForSymbols(stmt ast.Statement, scope *Sco
 		}
 
 		for _, ensnare := range node.EnsnareClauses {
+			st.collectExpressionReferences(ensnare.Condition, scope)
 			if ensnare.Alias != nil {
-				line := 0
-				tokenPos := extractPositionFromToken(ensnare.Token)
-				line = tokenPos.Line
-
-				exceptionSymbol := &Symbol{
-					Name:           ensnare.Alias.Value,
-					Type:           "variable",
-					DefinitionURI:  st.CurrentURI,
-					DefinitionLine: line,
-				}
-				scope.Symbols[ensnare.Alias.Value] = exceptionSymbol
+				st.declareVariable(ensnare.Alias, ensnare.Token, scope)
 			}
 
 			if ensnare.Consequence != nil {
@@ -513,6 +770,13 @@ func (st *SymbolTable) processStatementForSymbols(stmt ast.Statement, scope *Sco
 				st.processStatementForSymbols(s, scope)
 			}
 		}
+
+	case nil, *ast.ImportStatement, *ast.ArcaneGrimoire,
+		*ast.IgnoreStatement, *ast.StopStatement, *ast.SkipStatement:
+
+	default:
+		// Statements the parser may add later could read any variable
+		scope.markUnknownReads()
 	}
 }
 
@@ -525,7 +789,7 @@ func (st *SymbolTable) GetCurrentGrimoire(uri string, line int) *GrimoireSymbol
 
 	for _, symbol := range fileScope.Symbols {
 		if symbol.Type == "Grimoire" && symbol.Scope != nil && symbol.Scope.Grimoire != nil {
-			if line >= symbol.DefinitionLine {
+			if line >= symbol.Scope.StartLine && line <= symbol.Scope.EndLine {
 				return symbol.Scope.Grimoire
 			}
 		}
@@ -553,7 +817,7 @@ func (st *SymbolTable) GetLocalSymbols(uri string, line int) []*Symbol {
 		}
 	}
 
-	return symbols
+	return append(symbols, st.ImportedSymbols(uri)...)
 }
 
 // findScopeAtPosition finds the most specific scope at the given position
@@ -617,7 +881,7 @@ func (st *SymbolTable) LookupSymbol(name string, uri string) *Symbol {
 		}
 	}
 
-	return nil
+	return st.ImportedSymbol(name, uri)
 }
 
 // lookupSymbolInScope looks for a symbol in a specific scope and its children
@@ -637,6 +901,20 @@ func (st *SymbolTable) lookupSymbolInScope(name string, scope *Scope) *Symbol {
 	return nil
 }
 
+// ParentGrimoire returns the Grimoire a Grimoire symbol inherits from, as
+// seen from the file defining it, or nil when it has no known parent
+func (st *SymbolTable) ParentGrimoire(symbol *Symbol) *Symbol {
+	if symbol == nil || symbol.Scope == nil || symbol.Scope.Grimoire == nil || symbol.Scope.Grimoire.ParentName == "" {
+		return nil
+	}
+
+	parent := st.LookupGlobalSymbol(symbol.Scope.Grimoire.ParentName, symbol.DefinitionURI)
+	if parent == nil || parent.Type != "Grimoire" {
+		return nil
+	}
+	return parent
+}
+
 // LookupGrimoire finds a Grimoire by name
 func (st *SymbolTable) LookupGrimoire(name string) *GrimoireSymbol {
 	Grimoire, ok := st.Grimoires[name]
@@ -0,0 +1,54 @@
+package symbols
+
+import (
+	"testing"
+
+	"github.com/javanhut/TheCarrionLanguage/src/ast"
+	"github.com/javanhut/TheCarrionLanguage/src/token"
+)
+
+func TestPlainParametersAreDeclared(t *testing.T) {
+	const uri = "file:///params.crl"
+	st := buildTable(t, uri, "grim Counter:\n"+
+		"    spell add(self, step, by: int = 1):\n"+
+		"        return step + by\n")
+
+	method := st.Grimoires["Counter"].FindMember("add")
+	names := make([]string, 0)
+	for _, param := range method.Parameters {
+		names = append(names, param.Name)
+	}
+	if len(names) != 2 || names[0] != "step" || names[1] != "by" {
+		t.Errorf("parameters = %v, want [step by]", names)
+	}
+
+	for _, ref := range st.References[uri] {
+		if !ref.IsDeclaration && ref.Symbol == nil {
+			t.Errorf("%s at %d:%d is not resolved", ref.Name, ref.Line, ref.Column)
+		}
+	}
+}
+
+func TestUnknownReadsAreMarked(t *testing.T) {
+	const uri = "file:///lambda.crl"
+	ident := func(name string) *ast.Identifier {
+		return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Line: 1, Column: 1}, Value: name}
+	}
+
+	// The body of a lambda is not walked, so it may read any local
+	spell := &ast.FunctionDefinition{
+		Token: token.Token{Type: token.SPELL, Literal: "spell", Line: 1, Column: 1},
+		Name:  ident("outer"),
+		Body: &ast.BlockStatement{Statements: []ast.Statement{
+			&ast.ExpressionStatement{Expression: &ast.FunctionLiteral{
+				Body: &ast.BlockStatement{},
+			}},
+		}},
+	}
+	st := NewSymbolTable()
+	st.BuildFromAST(&ast.Program{Statements: []ast.Statement{spell}}, uri, "")
+
+	if scope := st.FileScopes[uri].Symbols["outer"].Scope; !scope.UnknownReads {
+		t.Error("the scope of outer does not record its unknown reads")
+	}
+}